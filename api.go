@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/b13f/repligator/vertica"
+)
+
+const apiPrefix = `/api/v1`
+
+type apiStatus struct {
+	Version     string         `json:"version"`
+	Sources     []sourceStatus `json:"sources"`
+	Queue       apiQueue       `json:"queue"`
+	Destination vertica.Status `json:"destination"`
+}
+
+type apiResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+//result of replace, applied statements are not rolled back after error
+type apiReplaceResult struct {
+	apiResult
+	Applied int    `json:"applied"`
+	Total   int    `json:"total"`
+	Warning string `json:"warning"`
+}
+
+const replaceWarning = `Vertica commits DDL implicitly, statements are applied one by one and are not rolled back after error`
+
+type apiQueue struct {
+	Size     int `json:"size"`
+	Capacity int `json:"capacity"`
+}
+
+//return handlers of versioned JSON API
+func getAPIHandlers(receiver *vertica.Cache, queue *eventQueue) map[string]func(w http.ResponseWriter, r *http.Request) {
+	ret := make(map[string]func(w http.ResponseWriter, r *http.Request))
+
+	ret[apiPrefix+`/status`] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, apiStatus{
+			Version:     `v1`,
+			Sources:     sourcesState.list(queue),
+			Queue:       apiQueue{Size: len(queue.events), Capacity: cap(queue.events)},
+			Destination: receiver.GetStatus(),
+		})
+	}
+
+	ret[apiPrefix+`/sources`] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, sourcesState.list(queue))
+	}
+
+	ret[apiPrefix+`/tables`] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, receiver.GetStatus().Tables)
+	}
+
+	ret[apiPrefix+`/ddl`] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, receiver.GetPendingDDL())
+	}
+
+	//actions on pending DDL addressed by gtid, custom vsql in request body
+	for _, action := range []string{vertica.DDLSkip, vertica.DDLRetry, vertica.DDLApply, vertica.DDLReplace} {
+		action := action
+
+		ret[apiPrefix+`/ddl/`+action] = func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				writeJSONStatus(w, http.StatusMethodNotAllowed, apiResult{Error: `POST required`})
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeJSONStatus(w, http.StatusBadRequest, apiResult{Error: err.Error()})
+				return
+			}
+
+			vsql := vertica.SplitStatements(string(body))
+
+			applied, err := receiver.ResolveDDL(r.URL.Query().Get(`gtid`), action, vsql)
+
+			result := apiResult{OK: err == nil}
+			code := http.StatusOK
+
+			if err != nil {
+				result.Error = err.Error()
+				code = http.StatusConflict
+			}
+
+			if action == vertica.DDLReplace {
+				writeJSONStatus(w, code, apiReplaceResult{apiResult: result, Applied: applied, Total: len(vsql), Warning: replaceWarning})
+				return
+			}
+
+			writeJSONStatus(w, code, result)
+		}
+	}
+
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("API response error: %s", err.Error())
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/siddontang/go-mysql/client"
+
+	"github.com/b13f/repligator/ddlparser"
+	"github.com/b13f/repligator/isql"
+)
+
+//column rules
+const (
+	columnDrop = "drop"
+	columnHash = "hash"
+	columnNull = "null"
+)
+
+//vertica type of hashed column values
+const hashColumnType = "char(64)"
+
+var columnsSQL = `SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION`
+
+type configSourceTable struct {
+	Name    string
+	Columns map[string]string
+	Filter  string
+}
+
+//return column rules of source table by lower case column names, MySQL column names are case insensitive
+func (src configSource) columnRules(table isql.Table) map[string]string {
+	for _, schema := range src.Schemas {
+		if schema.Name != table.GetSchema() {
+			continue
+		}
+
+		for _, t := range schema.Tables {
+			if t.Name == table.GetName() && len(t.Columns) > 0 {
+				rules := make(map[string]string)
+				for column, rule := range t.Columns {
+					rules[strings.ToLower(column)] = rule
+				}
+				return rules
+			}
+		}
+	}
+
+	return nil
+}
+
+func (src configSource) hasColumnRules() bool {
+	for _, schema := range src.Schemas {
+		for _, t := range schema.Tables {
+			if len(t.Columns) > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//apply column rules to parsed ddl
+func (src configSource) applyDDLRules(ddl interface{}) interface{} {
+	switch t := ddl.(type) {
+	case isql.CreateTable:
+		if rules := src.columnRules(t.GetCreateTable()); len(rules) > 0 {
+			t.Columns = maskColumns(rules, t.GetColumns())
+			t.Constraints = maskConstraints(rules, t.GetConstraints())
+		}
+		return t
+	case isql.AlterTable:
+		if rules := src.columnRules(t.GetAlterTable()); len(rules) > 0 {
+			t.AddColumns = maskColumns(rules, t.GetAddColumns())
+			t.DropColumns = maskColumns(rules, t.GetDropColumns())
+			t.AddConstraints = maskConstraints(rules, t.GetAddConstraints())
+		}
+		return t
+	}
+
+	return ddl
+}
+
+//return source of dump by name, only source of config if name is empty
+func getDumpSource(name string) (src configSource, err error) {
+	if name == "" {
+		switch len(data.Sources) {
+		case 0:
+			return
+		case 1:
+			return data.Sources[0], nil
+		}
+
+		return src, fmt.Errorf(`config has %d sources, set source of dump with -ds`, len(data.Sources))
+	}
+
+	for _, src := range data.Sources {
+		if src.Name == name {
+			return src, nil
+		}
+	}
+
+	return src, fmt.Errorf(`source %s of dump not found in config`, name)
+}
+
+//remove dropped columns and change type of hashed
+func maskColumns(rules map[string]string, columns []isql.Column) (masked []isql.Column) {
+	for _, col := range columns {
+		switch rules[strings.ToLower(col.GetName())] {
+		case columnDrop:
+			continue
+		case columnHash:
+			col.Type = hashColumnType
+		}
+
+		masked = append(masked, col)
+	}
+
+	return
+}
+
+//remove constraints with dropped columns
+func maskConstraints(rules map[string]string, constraints []isql.Constraint) (masked []isql.Constraint) {
+ConstrLoop:
+	for _, key := range constraints {
+		for _, column := range key.GetColumns() {
+			//column name may have prefix length
+			if rules[strings.ToLower(strings.Split(column, "(")[0])] == columnDrop {
+				continue ConstrLoop
+			}
+		}
+
+		masked = append(masked, key)
+	}
+
+	return
+}
+
+//apply column rules to row values
+func maskRow(rules map[string]string, columns []string, salt string, row []interface{}) []interface{} {
+	masked := make([]interface{}, 0, len(row))
+
+	for i, val := range row {
+		if i < len(columns) {
+			switch rules[strings.ToLower(columns[i])] {
+			case columnDrop:
+				continue
+			case columnHash:
+				val = hashValue(salt, val)
+			case columnNull:
+				val = nil
+			}
+		}
+
+		masked = append(masked, val)
+	}
+
+	return masked
+}
+
+//sha256 of salted value
+func hashValue(salt string, val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []byte:
+		val = string(v)
+	}
+
+	sum := sha256.Sum256([]byte(salt + fmt.Sprint(val)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+//columns of binlog row can not be mapped to names, rules can not be applied to row
+type columnsError struct {
+	table  isql.Table
+	reason string
+}
+
+func (e columnsError) Error() string {
+	return fmt.Sprintf(`columns of %s.%s unknown: %s`, e.table.GetSchema(), e.table.GetName(), e.reason)
+}
+
+//source tables columns at binlog position, needed to apply column rules and filters to rows
+type sourceMeta struct {
+	src     configSource
+	conn    *client.Conn
+	columns map[isql.Table][]string
+	unknown map[isql.Table]bool //columns changed by ddl which can not be followed
+	filters map[isql.Table]rowFilter
+}
+
+func newSourceMeta(src configSource) (m *sourceMeta, err error) {
+	m = &sourceMeta{src: src, columns: make(map[isql.Table][]string), unknown: make(map[isql.Table]bool), filters: make(map[isql.Table]rowFilter)}
+
+	for _, schema := range src.Schemas {
+		for _, t := range schema.Tables {
+			if len(t.Filter) == 0 {
+				continue
+			}
+
+			table := isql.Table{Schema: schema.Name, Name: t.Name}
+
+			if m.filters[table], err = parseFilter(t.Filter); err != nil {
+				return m, fmt.Errorf(`filter for %s.%s: %s`, schema.Name, t.Name, err.Error())
+			}
+		}
+	}
+
+	return
+}
+
+//return column names of source table in binlog order, count is columns count of binlog row,
+//columns are read from source on first use and followed by ddl after it
+func (m *sourceMeta) getColumns(table isql.Table, count int) (columns []string, err error) {
+	if m.unknown[table] {
+		return nil, columnsError{table: table, reason: `changed by ddl which can not be followed, pause and resume source to read them again`}
+	}
+
+	columns, ok := m.columns[table]
+
+	if !ok {
+		if columns, err = m.loadColumns(table); err != nil {
+			return
+		}
+
+		m.columns[table] = columns
+	}
+
+	return columns, checkColumns(table, columns, count)
+}
+
+//binlog row can not be mapped to columns of other table version
+func checkColumns(table isql.Table, columns []string, count int) error {
+	if count > 0 && len(columns) != count {
+		return columnsError{table: table, reason: fmt.Sprintf(`binlog row has %d columns, known table has %d`, count, len(columns))}
+	}
+
+	return nil
+}
+
+//follow columns changes of replicated ddl, read on binlog position of ddl
+func (m *sourceMeta) trackDDL(schema, query string) {
+	//renamed, retyped or reordered columns are not known until source restart
+	if table, ok := ddlparser.UntrackedAlter(query, schema); ok {
+		delete(m.columns, table)
+		m.unknown[table] = true
+		return
+	}
+
+	switch t := ddlparser.Ddlcase(query, schema).(type) {
+	case isql.CreateTable:
+		columns := make([]string, 0, len(t.GetColumns()))
+		for _, col := range t.GetColumns() {
+			columns = append(columns, col.GetName())
+		}
+
+		m.columns[t.GetCreateTable()] = columns
+		delete(m.unknown, t.GetCreateTable())
+	case isql.CreateTableLike:
+		m.copyColumns(t.GetLikeTable(), t.GetTable())
+	case []isql.RenameTable:
+		for _, r := range t {
+			m.copyColumns(r.GetFrom(), r.GetTo())
+			m.forget(r.GetFrom())
+		}
+	case []isql.DropTable:
+		for _, d := range t {
+			m.forget(d.Table)
+		}
+	case isql.AlterTable:
+		m.alterColumns(t)
+	}
+}
+
+//added columns are last, columns read from source after alter are not added again
+func (m *sourceMeta) alterColumns(alter isql.AlterTable) {
+	columns, ok := m.columns[alter.GetAlterTable()]
+	if !ok {
+		return
+	}
+
+	altered := make([]string, 0, len(columns)+len(alter.GetAddColumns()))
+
+	for _, name := range columns {
+		if !hasColumnName(alter.GetDropColumns(), name) {
+			altered = append(altered, name)
+		}
+	}
+
+	for _, col := range alter.GetAddColumns() {
+		if !containsFold(altered, col.GetName()) {
+			altered = append(altered, col.GetName())
+		}
+	}
+
+	m.columns[alter.GetAlterTable()] = altered
+}
+
+//columns of new table are those of source table
+func (m *sourceMeta) copyColumns(from, to isql.Table) {
+	m.forget(to)
+
+	if m.unknown[from] {
+		m.unknown[to] = true
+	}
+
+	if columns, ok := m.columns[from]; ok {
+		m.columns[to] = append([]string{}, columns...)
+	}
+}
+
+//forget dropped table, columns of new table with same name are read from source
+func (m *sourceMeta) forget(table isql.Table) {
+	delete(m.columns, table)
+	delete(m.unknown, table)
+}
+
+func hasColumnName(columns []isql.Column, name string) bool {
+	for _, col := range columns {
+		if strings.EqualFold(col.GetName(), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//read column names of source table
+func (m *sourceMeta) loadColumns(table isql.Table) (columns []string, err error) {
+	if m.conn == nil {
+		if m.conn, err = client.Connect(fmt.Sprintf("%s:%d", m.src.Host, m.src.Port), m.src.User, m.src.Password, ""); err != nil {
+			return
+		}
+	}
+
+	res, err := m.conn.Execute(columnsSQL, table.GetSchema(), table.GetName())
+	if err != nil {
+		return
+	}
+
+	var name string
+	for i := 0; i < res.RowNumber(); i++ {
+		if name, err = res.GetString(i, 0); err != nil {
+			return
+		}
+		columns = append(columns, name)
+	}
+
+	return
+}
+
+//apply filter, column and mapping rules to table rows, rows with unknown columns are dropped
+func (m *sourceMeta) applyRules(rowEv isql.TableRowsEvent) (applied isql.TableRowsEvent, err error) {
+	if applied, err = m.filterRows(rowEv); err == nil && len(applied.GetRows()) > 0 {
+		applied, err = m.maskRows(applied)
+	}
+
+	if cerr, ok := err.(columnsError); ok {
+		m.dropRows(rowEv, cerr)
+		return isql.TableRowsEvent{Table: rowEv.GetTable()}, nil
+	}
+
+	if err != nil || len(applied.GetRows()) == 0 {
+		return
+	}
+
+	applied.Table = mapTable(m.src.Mapping, applied.GetTable())
+
+	return applied, nil
+}
+
+//rules can not be applied to rows, they are not written to destination
+func (m *sourceMeta) dropRows(rowEv isql.TableRowsEvent, err columnsError) {
+	var count int
+	for _, rows := range rowEv.GetRows() {
+		count += len(rows.GetValues())
+	}
+
+	rowsDropped.WithLabelValues(m.src.Name).Add(float64(count))
+	log.Errorf("source %s: %d rows dropped, %s", m.src.Name, count, err.Error())
+}
+
+//remove rows out of table filter, updates moving row out of filter become deletes and moving in become inserts
+func (m *sourceMeta) filterRows(rowEv isql.TableRowsEvent) (filtered isql.TableRowsEvent, err error) {
+	filter, ok := m.filters[rowEv.GetTable()]
+
+	if !ok {
+		return rowEv, nil
+	}
+
+	columnNames, err := m.getColumns(rowEv.GetTable(), rowEv.ColumnCount)
+	if err != nil {
+		return
+	}
+
+	columns := make(map[string]int)
+	for i, name := range columnNames {
+		columns[strings.ToLower(name)] = i
+	}
+
+	if err = filter.check(columns); err != nil {
+		return filtered, fmt.Errorf(`filter for %s.%s: %s`, rowEv.GetTable().GetSchema(), rowEv.GetTable().GetName(), err.Error())
+	}
+
+	filtered = isql.TableRowsEvent{Table: rowEv.GetTable(), Query: rowEv.Query}
+
+	for _, rows := range rowEv.GetRows() {
+		values := rows.GetValues()
+
+		if rows.GetType() != isql.Update {
+			kept := isql.Rows{Type: rows.GetType()}
+
+			for _, row := range values {
+				if filter.match(columns, row) {
+					kept.Values = append(kept.Values, row)
+				}
+			}
+
+			if len(kept.Values) > 0 {
+				filtered.Rows = append(filtered.Rows, kept)
+			}
+			continue
+		}
+
+		dels := isql.Rows{Type: isql.Delete}
+		upds := isql.Rows{Type: isql.Update}
+		ins := isql.Rows{Type: isql.Insert}
+
+		//update rows are pairs of before and after images
+		for i := 0; i+1 < len(values); i += 2 {
+			before, after := filter.match(columns, values[i]), filter.match(columns, values[i+1])
+
+			switch {
+			case before && after:
+				upds.Values = append(upds.Values, values[i], values[i+1])
+			case before:
+				dels.Values = append(dels.Values, values[i])
+			case after:
+				ins.Values = append(ins.Values, values[i+1])
+			}
+		}
+
+		for _, r := range []isql.Rows{dels, upds, ins} {
+			if len(r.Values) > 0 {
+				filtered.Rows = append(filtered.Rows, r)
+			}
+		}
+	}
+
+	return
+}
+
+//apply column rules to table rows
+func (m *sourceMeta) maskRows(rowEv isql.TableRowsEvent) (masked isql.TableRowsEvent, err error) {
+	rules := m.src.columnRules(rowEv.GetTable())
+
+	if len(rules) == 0 {
+		return rowEv, nil
+	}
+
+	columns, err := m.getColumns(rowEv.GetTable(), rowEv.ColumnCount)
+	if err != nil {
+		return
+	}
+
+	for i, rows := range rowEv.GetRows() {
+		for j, row := range rows.GetValues() {
+			rowEv.Rows[i].Values[j] = maskRow(rules, columns, data.HashSalt, row)
+		}
+	}
+
+	return rowEv, nil
+}
+
+func (m *sourceMeta) close() {
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/b13f/repligator/vertica"
+)
+
+//wait of flush on pause, apply loop may be blocked by pending DDL
+var pauseFlushTimeout = time.Minute
+
+//running listenSource goroutine
+type runningSource struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+//starts, reconnects, pauses and resumes sources
+type sourceControl struct {
+	sync.Mutex
+	stop     context.Context
+	sources  sync.WaitGroup
+	queue    *eventQueue
+	reclaim  chan configSource
+	receiver *vertica.Cache
+	configs  map[string]configSource
+	running  map[string]runningSource
+	paused   map[string]bool
+	stopping bool
+}
+
+func newSourceControl(stop context.Context, queue *eventQueue, receiver *vertica.Cache) *sourceControl {
+	c := &sourceControl{
+		stop:     stop,
+		queue:    queue,
+		reclaim:  make(chan configSource),
+		receiver: receiver,
+		configs:  make(map[string]configSource),
+		running:  make(map[string]runningSource),
+		paused:   make(map[string]bool),
+	}
+
+	go c.reconnect()
+
+	return c
+}
+
+//start source from last written position
+func (c *sourceControl) start(src configSource) (err error) {
+	//check for existed position in source
+	lastPosition, err := c.receiver.GetLastPosition(src.Name)
+	if err != nil {
+		return
+	}
+
+	if len(lastPosition) > 0 {
+		src.Gtid = lastPosition
+	}
+
+	if src.TryAfter == 0 {
+		src.TryAfter = defaultTryAfter
+	}
+
+	ctx, cancel := context.WithCancel(c.stop)
+	done := make(chan struct{})
+
+	c.Lock()
+	//no new listeners after shutdown began waiting for sources
+	if c.stopping || c.stop.Err() != nil {
+		c.Unlock()
+		cancel()
+		return
+	}
+
+	//pending reconnect after pause and resume, source already listened
+	if _, ok := c.running[src.Name]; ok || c.paused[src.Name] {
+		c.Unlock()
+		cancel()
+		log.Infof("Source %s already running or paused, start skipped", src.Name)
+		return
+	}
+
+	c.configs[src.Name] = src
+	c.running[src.Name] = runningSource{cancel: cancel, done: done}
+	c.sources.Add(1)
+	c.Unlock()
+
+	go func() {
+		defer c.sources.Done()
+		defer close(done)
+
+		listenSource(ctx, src, c.queue, c.reclaim)
+
+		c.Lock()
+		if c.running[src.Name].done == done {
+			delete(c.running, src.Name)
+		}
+		c.Unlock()
+	}()
+
+	return
+}
+
+//reconnect to source if errors
+func (c *sourceControl) reconnect() {
+	for {
+		canceled := <-c.reclaim
+
+		time.AfterFunc(time.Minute*canceled.TryAfter, func() {
+			if c.stop.Err() != nil || c.isPaused(canceled.Name) {
+				return
+			}
+
+			log.Infof("Reconnect to %s", canceled.Name)
+			sourceReconnects.WithLabelValues(canceled.Name).Inc()
+
+			if err := c.start(canceled); err != nil {
+				log.Fatal(err.Error())
+			}
+		})
+	}
+}
+
+//wait all sources stopped, later starts are refused
+func (c *sourceControl) wait() {
+	c.Lock()
+	c.stopping = true
+	c.Unlock()
+
+	c.sources.Wait()
+}
+
+func (c *sourceControl) isPaused(name string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.paused[name]
+}
+
+//Pause stop source and write its applied events with position
+func (c *sourceControl) Pause(name string) error {
+	c.Lock()
+	if _, ok := c.configs[name]; !ok {
+		c.Unlock()
+		return fmt.Errorf(`source %s not found`, name)
+	}
+
+	if c.paused[name] {
+		c.Unlock()
+		return fmt.Errorf(`source %s already paused`, name)
+	}
+
+	c.paused[name] = true
+	running, ok := c.running[name]
+	c.Unlock()
+
+	if ok {
+		running.cancel()
+
+		select {
+		case <-running.done:
+		case <-time.After(pauseFlushTimeout):
+			return fmt.Errorf(`source %s paused, reader not stopped in %s`, name, pauseFlushTimeout)
+		}
+	}
+
+	sourcesState.setState(name, sourcePaused, nil)
+
+	//events of source sent before stop are applied first, apply loop may wait action on DDL
+	flush, cancel := context.WithTimeout(c.stop, pauseFlushTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go c.queue.send(flush, name, isql.FlushEvent{Done: done})
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf(`source %s paused, flush error: %s`, name, err.Error())
+		}
+	case <-flush.Done():
+		return fmt.Errorf(`source %s paused, flush not done in %s`, name, pauseFlushTimeout)
+	}
+
+	log.Infof("Source %s paused", name)
+
+	return nil
+}
+
+//Resume start paused source from its position
+func (c *sourceControl) Resume(name string) error {
+	c.Lock()
+	src, ok := c.configs[name]
+	paused := c.paused[name]
+	delete(c.paused, name)
+	c.Unlock()
+
+	if !ok {
+		return fmt.Errorf(`source %s not found`, name)
+	}
+
+	if !paused {
+		return fmt.Errorf(`source %s not paused`, name)
+	}
+
+	log.Infof("Source %s resumed", name)
+
+	return c.start(src)
+}
+
+//Paused return names of paused sources
+func (c *sourceControl) Paused() (names []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for name := range c.paused {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return
+}
@@ -44,6 +44,36 @@ func Ddlcase(sql string, schema string) interface{} {
 	return dp.getTypeStruct()
 }
 
+//words of ALTER TABLE changing columns in a way not described by Ddlcase
+var untrackedAlter = []string{"MODIFY", "CHANGE", "RENAME", "AFTER", "FIRST"}
+
+//UntrackedAlter return table of ALTER TABLE statement which renames, retypes or reorders columns
+func UntrackedAlter(sql string, schema string) (table isql.Table, ok bool) {
+	dp, err := newDdlParser(sql, schema)
+
+	if err != nil || dp.skip || dp.ddlType != alterTable || len(dp.scanned) < 3 {
+		return
+	}
+
+	for _, val := range dp.scanned[3:] {
+		for _, word := range untrackedAlter {
+			if up(val) == word {
+				ok = true
+			}
+		}
+	}
+
+	if !ok {
+		return
+	}
+
+	if len(dp.scanned) > 4 && dp.scanned[3] == "." {
+		return isql.Table{Schema: tr(dp.scanned[2]), Name: tr(dp.scanned[4])}, true
+	}
+
+	return isql.Table{Schema: schema, Name: tr(dp.scanned[2])}, true
+}
+
 var comment = regexp.MustCompile("/\\*.*?\\*/")
 
 // del comment in sql
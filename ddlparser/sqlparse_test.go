@@ -205,6 +205,22 @@ func (s *DDLParseTestSuite) TestSkippedDDL() {
 	}
 }
 
+func (s *DDLParseTestSuite) TestUntrackedAlter() {
+	table, ok := UntrackedAlter("ALTER TABLE test1.`test` CHANGE `a` `b` INT", `test2`)
+	s.True(ok)
+	s.Equal(isql.Table{Schema: `test1`, Name: `test`}, table)
+
+	table, ok = UntrackedAlter("ALTER TABLE test ADD COLUMN c INT AFTER a", `test2`)
+	s.True(ok)
+	s.Equal(isql.Table{Schema: `test2`, Name: `test`}, table)
+
+	_, ok = UntrackedAlter("ALTER TABLE test ADD COLUMN c INT, DROP INDEX b", `test2`)
+	s.False(ok)
+
+	_, ok = UntrackedAlter("DROP TABLE test", `test2`)
+	s.False(ok)
+}
+
 func TestEventsTestSuite(t *testing.T) {
 	suite.Run(t, new(DDLParseTestSuite))
 }
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//row filter tokens
+const (
+	tokenEnd = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+	tokenLeft
+	tokenRight
+	tokenComma
+)
+
+type filterToken struct {
+	kind  int
+	value string
+}
+
+//rowFilter is compiled filter expression, match row by lower case column names
+type rowFilter interface {
+	match(columns map[string]int, row []interface{}) bool
+	check(columns map[string]int) error
+}
+
+type filterAnd struct {
+	left, right rowFilter
+}
+
+func (f filterAnd) match(columns map[string]int, row []interface{}) bool {
+	return f.left.match(columns, row) && f.right.match(columns, row)
+}
+
+func (f filterAnd) check(columns map[string]int) error {
+	if err := f.left.check(columns); err != nil {
+		return err
+	}
+	return f.right.check(columns)
+}
+
+type filterOr struct {
+	left, right rowFilter
+}
+
+func (f filterOr) match(columns map[string]int, row []interface{}) bool {
+	return f.left.match(columns, row) || f.right.match(columns, row)
+}
+
+func (f filterOr) check(columns map[string]int) error {
+	if err := f.left.check(columns); err != nil {
+		return err
+	}
+	return f.right.check(columns)
+}
+
+type filterNot struct {
+	expr rowFilter
+}
+
+func (f filterNot) match(columns map[string]int, row []interface{}) bool {
+	return !f.expr.match(columns, row)
+}
+
+func (f filterNot) check(columns map[string]int) error {
+	return f.expr.check(columns)
+}
+
+type filterCompare struct {
+	column string
+	op     string
+	values []filterToken
+}
+
+//unknown column would drop all rows of table
+func (f filterCompare) check(columns map[string]int) error {
+	if _, ok := columns[f.column]; !ok {
+		return fmt.Errorf(`filter column %s not found in table`, f.column)
+	}
+	return nil
+}
+
+func (f filterCompare) match(columns map[string]int, row []interface{}) bool {
+	pos, ok := columns[f.column]
+	if !ok || pos >= len(row) {
+		return false
+	}
+
+	val := row[pos]
+
+	switch f.op {
+	case "IS NULL":
+		return val == nil
+	case "IS NOT NULL":
+		return val != nil
+	}
+
+	//NULL is not equal to anything
+	if val == nil {
+		return false
+	}
+
+	switch f.op {
+	case "IN", "NOT IN":
+		in := false
+		for _, v := range f.values {
+			if compareValue(val, v) == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (f.op == "IN")
+	}
+
+	cmp := compareValue(val, f.values[0])
+
+	switch f.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+
+	return false
+}
+
+//compare row value with literal, numbers compared as integers or float
+func compareValue(val interface{}, literal filterToken) int {
+	var str string
+
+	switch v := val.(type) {
+	case []byte:
+		str = string(v)
+	default:
+		str = fmt.Sprint(v)
+	}
+
+	if literal.kind == tokenNumber {
+		if cmp, ok := compareNumbers(str, literal.value); ok {
+			return cmp
+		}
+	}
+
+	return strings.Compare(str, literal.value)
+}
+
+//compare numbers without float rounding of BIGINT values
+func compareNumbers(a, b string) (int, bool) {
+	i1, errI1 := strconv.ParseInt(a, 10, 64)
+	i2, errI2 := strconv.ParseInt(b, 10, 64)
+
+	if errI1 == nil && errI2 == nil {
+		return compareOrdered(i1 < i2, i1 > i2), true
+	}
+
+	u1, errU1 := strconv.ParseUint(a, 10, 64)
+	u2, errU2 := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case errU1 == nil && errU2 == nil:
+		return compareOrdered(u1 < u2, u1 > u2), true
+	//unsigned over int64 range against negative
+	case errU1 == nil && errI2 == nil:
+		return 1, true
+	case errI1 == nil && errU2 == nil:
+		return -1, true
+	}
+
+	f1, errF1 := strconv.ParseFloat(a, 64)
+	f2, errF2 := strconv.ParseFloat(b, 64)
+
+	if errF1 == nil && errF2 == nil {
+		return compareOrdered(f1 < f2, f1 > f2), true
+	}
+
+	return 0, false
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+//split filter expression to tokens
+func filterTokens(expr string) (tokens []filterToken, err error) {
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLeft, value: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRight, value: ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{kind: tokenComma, value: ","})
+			i++
+		case r == '\'':
+			var str []rune
+			i++
+			for ; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					//escaped quote
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+				str = append(str, runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf(`unclosed string in filter: %s`, expr)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, value: string(str)})
+			i++
+		case r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != '`' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf(`unclosed identifier in filter: %s`, expr)
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, value: string(runes[i+1 : j])})
+			i = j + 1
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			for j < len(runes) && strings.ContainsRune("=<>", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenOp, value: string(runes[i:j])})
+			i = j
+		case unicode.IsDigit(r) || (r == '-' || r == '.') && startsNumber(runes[i:], tokens):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, value: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, value: string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf(`unexpected symbol %q in filter: %s`, r, expr)
+		}
+	}
+
+	return append(tokens, filterToken{kind: tokenEnd}), nil
+}
+
+//sign or dot starts number only before digit and not after value, a-b is not a number
+func startsNumber(runes []rune, tokens []filterToken) bool {
+	if runes[0] == '-' {
+		if len(tokens) > 0 {
+			switch tokens[len(tokens)-1].kind {
+			case tokenIdent, tokenNumber, tokenString, tokenRight:
+				return false
+			}
+		}
+		runes = runes[1:]
+	}
+
+	if len(runes) > 0 && runes[0] == '.' {
+		runes = runes[1:]
+	}
+
+	return len(runes) > 0 && unicode.IsDigit(runes[0])
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+//parseFilter compile filter expression like `tenant_id IN (1,2) AND status != 'draft'`
+func parseFilter(expr string) (filter rowFilter, err error) {
+	tokens, err := filterTokens(expr)
+	if err != nil {
+		return
+	}
+
+	p := &filterParser{tokens: tokens}
+
+	if filter, err = p.or(); err != nil {
+		return
+	}
+
+	if p.peek().kind != tokenEnd {
+		return nil, fmt.Errorf(`unexpected %s in filter: %s`, p.peek().value, expr)
+	}
+
+	return
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+//check next token is keyword and skip it
+func (p *filterParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenIdent && strings.ToUpper(t.value) == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filter rowFilter, err error) {
+	if filter, err = p.and(); err != nil {
+		return
+	}
+
+	for p.keyword("OR") {
+		var right rowFilter
+		if right, err = p.and(); err != nil {
+			return
+		}
+		filter = filterOr{left: filter, right: right}
+	}
+
+	return
+}
+
+func (p *filterParser) and() (filter rowFilter, err error) {
+	if filter, err = p.not(); err != nil {
+		return
+	}
+
+	for p.keyword("AND") {
+		var right rowFilter
+		if right, err = p.not(); err != nil {
+			return
+		}
+		filter = filterAnd{left: filter, right: right}
+	}
+
+	return
+}
+
+func (p *filterParser) not() (filter rowFilter, err error) {
+	if p.keyword("NOT") {
+		if filter, err = p.not(); err != nil {
+			return
+		}
+		return filterNot{expr: filter}, nil
+	}
+
+	if p.peek().kind == tokenLeft {
+		p.next()
+		if filter, err = p.or(); err != nil {
+			return
+		}
+		if p.next().kind != tokenRight {
+			return nil, fmt.Errorf(`expected ) in filter`)
+		}
+		return
+	}
+
+	return p.compare()
+}
+
+func (p *filterParser) compare() (filter rowFilter, err error) {
+	column := p.next()
+	if column.kind != tokenIdent {
+		return nil, fmt.Errorf(`expected column name, got %q`, column.value)
+	}
+
+	cmp := filterCompare{column: strings.ToLower(column.value)}
+
+	switch {
+	case p.keyword("IS"):
+		if cmp.op = "IS NULL"; p.keyword("NOT") {
+			cmp.op = "IS NOT NULL"
+		}
+		if !p.keyword("NULL") {
+			return nil, fmt.Errorf(`expected NULL after IS for %s`, column.value)
+		}
+		return cmp, nil
+	case p.keyword("NOT"):
+		if !p.keyword("IN") {
+			return nil, fmt.Errorf(`expected IN after NOT for %s`, column.value)
+		}
+		cmp.op = "NOT IN"
+	case p.keyword("IN"):
+		cmp.op = "IN"
+	case p.peek().kind == tokenOp:
+		cmp.op = p.next().value
+		switch cmp.op {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf(`unknown operator %s`, cmp.op)
+		}
+		value := p.next()
+		if value.kind != tokenNumber && value.kind != tokenString {
+			return nil, fmt.Errorf(`expected value for %s, got %q`, column.value, value.value)
+		}
+		cmp.values = append(cmp.values, value)
+		return cmp, nil
+	default:
+		return nil, fmt.Errorf(`expected operator for %s`, column.value)
+	}
+
+	//IN list
+	if p.next().kind != tokenLeft {
+		return nil, fmt.Errorf(`expected ( after IN for %s`, column.value)
+	}
+
+	for {
+		value := p.next()
+		if value.kind != tokenNumber && value.kind != tokenString {
+			return nil, fmt.Errorf(`expected value in IN list for %s, got %q`, column.value, value.value)
+		}
+		cmp.values = append(cmp.values, value)
+
+		if t := p.next(); t.kind == tokenRight {
+			break
+		} else if t.kind != tokenComma {
+			return nil, fmt.Errorf(`expected , or ) in IN list for %s`, column.value)
+		}
+	}
+
+	return cmp, nil
+}
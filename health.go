@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/b13f/repligator/vertica"
+)
+
+const defaultHealthTimeout = 600
+
+//source reconnect may take longer than retry delay
+const retryGrace = time.Minute
+
+type healthResponse struct {
+	OK      bool     `json:"ok"`
+	Reasons []string `json:"reasons"`
+}
+
+//return probe handlers, failed checks listed in reasons with 503 status
+func getHealthHandlers(receiver *vertica.Cache, sources []configSource, timeout int) map[string]func(w http.ResponseWriter, r *http.Request) {
+	ret := make(map[string]func(w http.ResponseWriter, r *http.Request))
+
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	ret[`/healthz`] = func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, checkLoop(receiver, time.Now(), time.Duration(timeout)*time.Second))
+	}
+
+	ret[`/readyz`] = func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var reasons []string
+
+		if err := receiver.Ping(ctx); err != nil {
+			reasons = append(reasons, fmt.Sprintf("destination not reachable: %s", err.Error()))
+		}
+
+		reasons = append(reasons, checkDDL(receiver)...)
+		reasons = append(reasons, checkSources(sources, time.Now())...)
+
+		writeHealth(w, reasons)
+	}
+
+	return ret
+}
+
+//check apply loop and flush are not stuck, loop waiting action on DDL is alive
+func checkLoop(receiver *vertica.Cache, now time.Time, timeout time.Duration) (reasons []string) {
+	loopAt, flushStart, waitDDL := receiver.GetLoopState()
+
+	switch {
+	case waitDDL:
+	case !flushStart.IsZero():
+		if now.Sub(flushStart) > timeout {
+			reasons = append(reasons, fmt.Sprintf("flush running for %.0fs", now.Sub(flushStart).Seconds()))
+		}
+	case now.Sub(loopAt) > timeout:
+		reasons = append(reasons, fmt.Sprintf("apply loop stuck for %.0fs", now.Sub(loopAt).Seconds()))
+	}
+
+	return
+}
+
+//list DDL blocking replication until action on it
+func checkDDL(receiver *vertica.Cache) (reasons []string) {
+	for _, pending := range receiver.GetPendingDDL() {
+		reasons = append(reasons, fmt.Sprintf("waiting DDL %s of source %s: %s", pending.Gtid, pending.Source, pending.Error))
+	}
+
+	return
+}
+
+//check sources are connected or reconnecting within retry window
+func checkSources(sources []configSource, now time.Time) (reasons []string) {
+	for _, src := range sources {
+		status, ok := sourcesState.get(src.Name)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("source %s not started", src.Name))
+			continue
+		}
+
+		tryAfter := src.TryAfter
+		if tryAfter == 0 {
+			tryAfter = defaultTryAfter
+		}
+
+		switch status.State {
+		case sourceConnecting, sourceReconnecting:
+			if status.FailingSince != nil && now.Sub(*status.FailingSince) > time.Minute*tryAfter+retryGrace {
+				reasons = append(reasons, fmt.Sprintf("source %s not connected since %s: %s", src.Name, status.FailingSince.Format(time.RFC3339), status.Error))
+			}
+		case sourceStopped:
+			reasons = append(reasons, fmt.Sprintf("source %s stopped", src.Name))
+		}
+	}
+
+	return
+}
+
+func writeHealth(w http.ResponseWriter, reasons []string) {
+	if reasons == nil {
+		reasons = []string{}
+	}
+
+	code := http.StatusOK
+	if len(reasons) > 0 {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSONStatus(w, code, healthResponse{OK: len(reasons) == 0, Reasons: reasons})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/siddontang/go-mysql/client"
+
+	"github.com/b13f/repligator/isql"
+)
+
+var heartbeatCreateSQL = []string{
+	"CREATE DATABASE IF NOT EXISTS `%s`",
+	"CREATE TABLE IF NOT EXISTS `%s`.`" + isql.HeartbeatTable + "` (source VARCHAR(255) NOT NULL PRIMARY KEY, ts BIGINT NOT NULL) ENGINE=InnoDB",
+}
+
+//ts in milliseconds is free of time zones of source and destination
+var heartbeatSQL = "REPLACE INTO `%s`.`" + isql.HeartbeatTable + "` (source, ts) VALUES ('%s', ROUND(UNIX_TIMESTAMP(NOW(6))*1000))"
+
+//check source writes heartbeat rows
+func (src configSource) hasHeartbeatTable() bool {
+	return src.Heartbeat > 0 && len(src.HeartbeatSchema) > 0
+}
+
+//check table is heartbeat table of source, replicated regardless of schemas filter
+func (src configSource) isHeartbeatTable(table isql.Table) bool {
+	return src.hasHeartbeatTable() && table.GetSchema() == src.HeartbeatSchema && table.GetName() == isql.HeartbeatTable
+}
+
+//write heartbeat row on source until stop, replicated row measures latency to destination
+func runHeartbeat(stop context.Context, src configSource) {
+	var conn *client.Conn
+	var err error
+
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second * src.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if conn == nil {
+			if conn, err = connectHeartbeat(src); err != nil {
+				log.Warnf("heartbeat %s - %s : %s", src.Host, src.Name, err.Error())
+				continue
+			}
+		}
+
+		if _, err = conn.Execute(fmt.Sprintf(heartbeatSQL, src.HeartbeatSchema, src.Name)); err != nil {
+			log.Warnf("heartbeat %s - %s : %s", src.Host, src.Name, err.Error())
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+func connectHeartbeat(src configSource) (conn *client.Conn, err error) {
+	if conn, err = client.Connect(fmt.Sprintf("%s:%d", src.Host, src.Port), src.User, src.Password, ""); err != nil {
+		return
+	}
+
+	for _, sql := range heartbeatCreateSQL {
+		if _, err = conn.Execute(fmt.Sprintf(sql, src.HeartbeatSchema)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return
+}
@@ -12,3 +12,6 @@ const (
 	Update = "update"
 	Delete = "delete"
 )
+
+//HeartbeatTable is name of table written on sources to measure replication latency
+const HeartbeatTable = "repligator_heartbeat"
@@ -174,9 +174,10 @@ func (r Rows) GetValues() [][]interface{} {
 
 //TableRowsEvent description of rows events on table
 type TableRowsEvent struct {
-	Table Table
-	Query string
-	Rows  []Rows
+	Table       Table
+	Query       string
+	Rows        []Rows
+	ColumnCount int //columns count of table map event, 0 if unknown
 }
 
 //GetTable return Table
@@ -193,6 +194,8 @@ func (tre TableRowsEvent) GetRows() []Rows {
 type RowsEvent struct {
 	SourceName string
 	GtidSet    string
+	Gtid       string
+	Timestamp  uint32
 	TablesRows []TableRowsEvent
 }
 
@@ -206,6 +209,16 @@ func (re RowsEvent) GetGtidSet() string {
 	return re.GtidSet
 }
 
+//GetGtid return gtid of current transaction
+func (re RowsEvent) GetGtid() string {
+	return re.Gtid
+}
+
+//GetTimestamp return binlog timestamp of transaction
+func (re RowsEvent) GetTimestamp() uint32 {
+	return re.Timestamp
+}
+
 //GetTables return rows events on tables
 func (re RowsEvent) GetTables() []TableRowsEvent {
 	return re.TablesRows
@@ -217,6 +230,10 @@ type DdlEvent struct {
 	GtidSet    string
 	Schema     string
 	Query      string
+	Ddl        interface{}
+	Merge      bool
+	Gtid       string
+	Timestamp  uint32
 }
 
 //GetSourceName return source
@@ -238,3 +255,28 @@ func (de DdlEvent) GetSchema() string {
 func (de DdlEvent) GetQuery() string {
 	return de.Query
 }
+
+//GetDdl return parsed DDL rewritten by source, nil if not set
+func (de DdlEvent) GetDdl() interface{} {
+	return de.Ddl
+}
+
+//IsMerge return true if DDL changes table filled by several sources
+func (de DdlEvent) IsMerge() bool {
+	return de.Merge
+}
+
+//GetGtid return gtid of DDL transaction
+func (de DdlEvent) GetGtid() string {
+	return de.Gtid
+}
+
+//GetTimestamp return binlog timestamp of DDL
+func (de DdlEvent) GetTimestamp() uint32 {
+	return de.Timestamp
+}
+
+//FlushEvent asks destination to write cache with position, result sent to Done
+type FlushEvent struct {
+	Done chan error
+}
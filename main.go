@@ -7,13 +7,16 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/johntdyer/slackrus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/satori/go.uuid"
 	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/replication"
@@ -27,12 +30,15 @@ import (
 const defaultTryAfter = 5
 
 type config struct {
-	Sources     []configSource
-	Destination vertica.Config
-	Port        string
-	LogFile     string `yaml:"log_file"`
-	LogLevel    string `yaml:"log_level"`
-	Slack       struct {
+	Sources       []configSource
+	Destination   vertica.Config
+	Port          string
+	LogFile       string `yaml:"log_file"`
+	LogLevel      string `yaml:"log_level"`
+	HashSalt      string `yaml:"hash_salt"`
+	QueueSize     int    `yaml:"queue_size"`
+	HealthTimeout int    `yaml:"health_timeout"` //seconds without apply loop iteration before /healthz fails
+	Slack         struct {
 		BotToken string `yaml:"bot_token"`
 		Hook     string
 		Channel  string
@@ -42,17 +48,20 @@ type config struct {
 }
 
 type configSource struct {
-	Name     string
-	Type     string
-	ServerID uint32 `yaml:"server_id"`
-	Host     string
-	Port     uint16
-	User     string
-	Password string
-	Gtid     string
-	Timeout  time.Duration
-	TryAfter time.Duration `yaml:"try_after"`
-	Schemas  []configSourceSchema
+	Name            string
+	Type            string
+	ServerID        uint32 `yaml:"server_id"`
+	Host            string
+	Port            uint16
+	User            string
+	Password        string
+	Gtid            string
+	Timeout         time.Duration
+	TryAfter        time.Duration `yaml:"try_after"`
+	Heartbeat       time.Duration //seconds, replaces timeout of idle source
+	HeartbeatSchema string        `yaml:"heartbeat_schema"`
+	Schemas         []configSourceSchema
+	Mapping         []configMapping
 }
 
 type configSourceSchema struct {
@@ -60,15 +69,23 @@ type configSourceSchema struct {
 	TablesSync    []string `yaml:"sync"`
 	TablesExclude []string `yaml:"exclude"`
 	Gtid          string
+	Tables        []configSourceTable
 }
 
 var data config
 
 var configFile = flag.String("config", "config.yml", "path to config file")
 var dumpFolder = flag.String("df", ``, "path to dir with MySQL dump files")
+var dumpSource = flag.String("ds", ``, "name of source in config the dump is taken from, its column rules are applied")
 
 func runDumpMutate() {
-	out, err := getVsqlFromDir(*dumpFolder)
+	src, err := getDumpSource(*dumpSource)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	out, err := getVsqlFromDir(*dumpFolder, src)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
@@ -78,17 +95,28 @@ func runDumpMutate() {
 	os.Exit(0)
 }
 
-func configRead() {
+func configParse() (err error) {
 	bytes, err := ioutil.ReadFile(*configFile)
 
 	if err == nil {
 		err = yaml.Unmarshal(bytes, &data)
 	}
 
-	if err != nil {
+	return
+}
+
+func configRead() {
+	if err := configParse(); err != nil {
 		log.Fatal(err.Error())
 	}
 
+	//check filters expressions
+	for _, src := range data.Sources {
+		if _, err := newSourceMeta(src); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
 	if len(data.LogFile) > 0 {
 		f, err := os.OpenFile(data.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 
@@ -121,12 +149,21 @@ func main() {
 	flag.Parse()
 
 	if len(*dumpFolder) > 0 {
+		//column rules from config are applied to dump
+		if _, err := os.Stat(*configFile); err == nil {
+			if err = configParse(); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
 		runDumpMutate()
 	}
 
 	configRead()
 
-	eventsConnector := make(chan interface{})
+	eventsConnector := newEventQueue(data.QueueSize)
+	registerQueueMetrics(eventsConnector)
 
 	receiver, err := vertica.Init(data.Destination)
 
@@ -134,53 +171,22 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	skip := make(chan string)
-
-	cancel := make(chan configSource)
-
-	//reconnect to source if errors
-	go func() {
-		for {
-			canceled := <-cancel
-
-			time.AfterFunc(time.Minute*canceled.TryAfter, func() {
-				log.Infof("Reconnect to %s", canceled.Name)
-
-				lastPosition, err := receiver.GetLastPosition(canceled.Name)
-
-				if err != nil {
-					log.Fatal(err.Error())
-				}
-
-				if len(lastPosition) > 0 {
-					canceled.Gtid = lastPosition
-				}
-
-				listenSource(canceled, eventsConnector, cancel)
-			})
-		}
-	}()
+	//sources stopped on shutdown
+	stop, stopSources := context.WithCancel(context.Background())
+	sources := newSourceControl(stop, eventsConnector, receiver)
+	receiver.SetSourceController(sources)
 
 	for _, sourceConfig := range data.Sources {
-		//check for existed position in source
-		lastPosition, err := receiver.GetLastPosition(sourceConfig.Name)
-
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-
-		if len(lastPosition) > 0 {
-			sourceConfig.Gtid = lastPosition
+		if sourceConfig.hasHeartbeatTable() {
+			receiver.SetHeartbeatSchema(sourceConfig.Name, sourceConfig.HeartbeatSchema)
 		}
 
-		if sourceConfig.TryAfter == 0 {
-			sourceConfig.TryAfter = defaultTryAfter
+		if err = sources.start(sourceConfig); err != nil {
+			log.Fatal(err.Error())
 		}
-
-		go listenSource(sourceConfig, eventsConnector, cancel)
 	}
 
-	receiverError := receiver.ApplyEvent(eventsConnector, skip)
+	receiverError := receiver.ApplyEvent(eventsConnector.events)
 
 	//init bot
 	if data.Slack.BotToken != "" {
@@ -195,7 +201,12 @@ func main() {
 					continue
 				}
 
-				for cmd, vfunc := range receiver.GetBotInterfaces(skip) {
+				if msg == "queue" {
+					slackbot.send(eventsConnector.info())
+					continue
+				}
+
+				for cmd, vfunc := range receiver.GetBotInterfaces() {
 					if strings.HasPrefix(msg, cmd) {
 						slackbot.send(vfunc(msg))
 						continue
@@ -207,7 +218,21 @@ func main() {
 
 	mux := http.NewServeMux()
 
-	for path, vfunc := range receiver.GetHTTPInterfaces(skip) {
+	mux.Handle(`/metrics`, promhttp.Handler())
+
+	mux.HandleFunc(`/queue`, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", eventsConnector.info())
+	})
+
+	for path, vfunc := range getAPIHandlers(receiver, eventsConnector) {
+		mux.HandleFunc(path, vfunc)
+	}
+
+	for path, vfunc := range getHealthHandlers(receiver, data.Sources, data.HealthTimeout) {
+		mux.HandleFunc(path, vfunc)
+	}
+
+	for path, vfunc := range receiver.GetHTTPInterfaces() {
 		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 			vfunc(w, r)
 		})
@@ -223,22 +248,54 @@ func main() {
 	go func() {
 		err := s.ListenAndServe()
 
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal(err.Error())
 		}
 	}()
 
-	if err != nil {
-		log.Fatal(err.Error())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err = <-receiverError:
+		log.Fatalf("Apply error: %s", err.Error())
+	case sig := <-signals:
+		log.Infof("Got %s, shutting down", sig)
 	}
 
-	for {
-		err = <-receiverError
-		panic(err.Error())
+	//applied events before stop flushed with position
+	stopSources()
+	sources.wait()
+
+	eventsConnector.events <- true
+
+	if err = <-receiverError; err != nil {
+		log.Fatalf("Final flush error: %s", err.Error())
 	}
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+
+	if err = s.Shutdown(ctx); err != nil {
+		log.Warnf("HTTP shutdown error: %s", err.Error())
+	}
+
+	log.Info("Stopped")
 }
 
-func listenSource(src configSource, send chan interface{}, cancelSource chan configSource) {
+func listenSource(stop context.Context, src configSource, queue *eventQueue, cancelSource chan configSource) {
+	sourcesState.setState(src.Name, sourceConnecting, nil)
+
+	meta, err := newSourceMeta(src)
+
+	if err != nil {
+		log.Warn(err)
+		sourcesState.setState(src.Name, sourceReconnecting, err)
+		cancelSource <- src
+		return
+	}
+
+	defer meta.close()
 
 	cfg := replication.BinlogSyncerConfig{
 		ServerID: src.ServerID,
@@ -249,12 +306,21 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 		Password: src.Password,
 		LogLevel: "warn",
 	}
+
+	//idle source sends heartbeat events, timeout means lost connection
+	timeout := time.Second * src.Timeout
+	if src.Heartbeat > 0 {
+		cfg.HeartbeatPeriod = time.Second * src.Heartbeat
+		timeout = 3 * cfg.HeartbeatPeriod
+	}
+
 	syncer := replication.NewBinlogSyncer(&cfg)
 
 	gtid, err := mysql.ParseGTIDSet(src.Type, src.Gtid)
 
 	if err != nil {
 		log.Warn(err)
+		sourcesState.setState(src.Name, sourceReconnecting, err)
 		cancelSource <- src
 		return
 	}
@@ -263,23 +329,45 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 
 	if err != nil {
 		log.Warn(err)
+		sourcesState.setState(src.Name, sourceReconnecting, err)
 		cancelSource <- src
 		return
 	}
 
+	sourcesState.setState(src.Name, sourceConnected, nil)
+	sourcesState.setGtid(src.Name, src.Gtid)
+
+	if src.hasHeartbeatTable() {
+		heartbeat, stopHeartbeat := context.WithCancel(stop)
+		defer stopHeartbeat()
+
+		go runHeartbeat(heartbeat, src)
+	}
+
 	gtidSet := getGtidSet(src.Gtid)
+	var currentGtid string
 
 	var rowsEvent isql.TableRowsEvent
 	var rowsEvents []isql.TableRowsEvent
 
 	for {
-		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*src.Timeout)
+		ctx, cancel := context.WithTimeout(stop, timeout)
 
 		ev, err := streamer.GetEvent(ctx)
 
+		//shutdown, not flushed events read again from position
+		if stop.Err() != nil {
+			syncer.Close()
+			log.Infof("source %s stopped", src.Name)
+			sourcesState.setState(src.Name, sourceStopped, nil)
+			cancel()
+			return
+		}
+
 		if ctx.Err() != nil {
 			syncer.Close()
 			log.Warnf("timeout source, %s closed", src.Host)
+			sourcesState.setState(src.Name, sourceReconnecting, ctx.Err())
 			cancelSource <- src
 			cancel()
 			return
@@ -288,11 +376,14 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 		if err != nil {
 			syncer.Close()
 			log.Warnf("event error %s - %s : %s", src.Host, src.Name, err.Error())
+			sourcesState.setState(src.Name, sourceReconnecting, err)
 			cancelSource <- src
 			cancel()
 			return
 		}
 
+		sourcesState.setEvent(src.Name, ev.Header.Timestamp)
+
 		switch t := ev.Event.(type) {
 		case *replication.GTIDEvent:
 			u, _ := uuid.FromBytes(t.SID)
@@ -306,6 +397,7 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 			gtid.Last = fmt.Sprintf("%d", t.GNO)
 
 			gtidSet[u.String()] = gtid
+			currentGtid = u.String() + ":" + gtid.Last
 		case *replication.QueryEvent:
 			switch string(t.Query) {
 			case `BEGIN`:
@@ -314,12 +406,20 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 				continue
 			default:
 				//TODO: get table and schema for ddl
-				send <- isql.DdlEvent{
-					SourceName: src.Name,
-					Schema:     string(t.Schema),
-					Query:      string(t.Query),
-					GtidSet:    gtidSetToString(gtidSet),
+				ddl := getDdlEvent(src, string(t.Schema), string(t.Query), gtidSetToString(gtidSet))
+				ddl.Gtid = currentGtid
+				ddl.Timestamp = ev.Header.Timestamp
+
+				eventsReceived.WithLabelValues(src.Name, `ddl`).Inc()
+				if !queue.send(stop, src.Name, ddl) {
+					syncer.Close()
+					log.Infof("source %s stopped", src.Name)
+					sourcesState.setState(src.Name, sourceStopped, nil)
+					cancel()
+					return
 				}
+				sourcesState.setGtid(src.Name, gtidSetToString(gtidSet))
+				meta.trackDDL(string(t.Schema), string(t.Query))
 			}
 		case *replication.RowsEvent:
 			tempRows := isql.Rows{}
@@ -346,6 +446,7 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 			}
 			rowsEvent = isql.TableRowsEvent{}
 			rowsEvent.Table = isql.Table{Name: string(t.Table), Schema: string(t.Schema)}
+			rowsEvent.ColumnCount = int(t.ColumnCount)
 		case *replication.RowsQueryEvent:
 			rowsEvent.Query = string(t.Query)
 		case *replication.XIDEvent:
@@ -355,6 +456,11 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 				rowsEventFiltered := rowsEvents[:0]
 
 				for _, rowEv := range rowsEvents {
+					if src.isHeartbeatTable(rowEv.GetTable()) {
+						rowsEventFiltered = append(rowsEventFiltered, rowEv)
+						continue
+					}
+
 					for schemaGtidPos, schema := range src.Schemas {
 						if rowEv.GetTable().GetSchema() != schema.Name {
 							continue
@@ -368,19 +474,7 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 							src.Schemas[schemaGtidPos].Gtid = ""
 						}
 
-						//tables to sync
-						if len(schema.TablesSync) > 0 {
-							if contains(schema.TablesSync, rowEv.GetTable().GetName()) {
-								rowsEventFiltered = append(rowsEventFiltered, rowEv)
-							}
-							// tables exclude
-						} else if len(schema.TablesExclude) > 0 {
-							if !contains(schema.TablesExclude, rowEv.GetTable().GetName()) {
-								rowsEventFiltered = append(rowsEventFiltered, rowEv)
-							}
-						}
-						//all tables in schema
-						if len(schema.TablesSync) == 0 && len(schema.TablesExclude) == 0 {
+						if schema.hasTable(rowEv.GetTable().GetName()) {
 							rowsEventFiltered = append(rowsEventFiltered, rowEv)
 						}
 					}
@@ -393,11 +487,47 @@ func listenSource(src configSource, send chan interface{}, cancelSource chan con
 				}
 			}
 
-			send <- isql.RowsEvent{
+			rowsEventApplied := rowsEvents[:0]
+
+			for _, rowEv := range rowsEvents {
+				if rowEv, err = meta.applyRules(rowEv); err != nil {
+					syncer.Close()
+					log.Warnf("rules error %s - %s : %s", src.Host, src.Name, err.Error())
+					sourcesState.setState(src.Name, sourceReconnecting, err)
+					cancelSource <- src
+					cancel()
+					return
+				}
+
+				if len(rowEv.GetRows()) > 0 {
+					rowsEventApplied = append(rowsEventApplied, rowEv)
+				}
+			}
+
+			rowsEvents = rowsEventApplied
+
+			if len(rowsEvents) == 0 {
+				continue
+			}
+
+			eventsReceived.WithLabelValues(src.Name, `rows`).Inc()
+			sent := queue.send(stop, src.Name, isql.RowsEvent{
 				SourceName: src.Name,
 				GtidSet:    gtidSetToString(gtidSet),
+				Gtid:       currentGtid,
+				Timestamp:  ev.Header.Timestamp,
 				TablesRows: rowsEvents,
+			})
+
+			//stopped while queue is full, not sent events read again from position
+			if !sent {
+				syncer.Close()
+				log.Infof("source %s stopped", src.Name)
+				sourcesState.setState(src.Name, sourceStopped, nil)
+				cancel()
+				return
 			}
+			sourcesState.setGtid(src.Name, gtidSetToString(gtidSet))
 
 		case *replication.RotateEvent:
 		case *replication.FormatDescriptionEvent:
@@ -465,7 +595,7 @@ func contains(s []string, e string) bool {
 	return false
 }
 
-func getVsqlFromDir(path string) (out string, err error) {
+func getVsqlFromDir(path string, src configSource) (out string, err error) {
 	files, err := ioutil.ReadDir(path)
 	if err != nil {
 		return
@@ -483,7 +613,7 @@ func getVsqlFromDir(path string) (out string, err error) {
 			return out, err
 		}
 
-		vsql, err := dumpAdopt(string(dataBytes))
+		vsql, err := dumpAdopt(string(dataBytes), src)
 		if err != nil {
 			return out, err
 		}
@@ -500,22 +630,22 @@ func getVsqlFromDir(path string) (out string, err error) {
 	return
 }
 
-func dumpAdopt(data string) (queries []string, err error) {
+func dumpAdopt(dump string, src configSource) (queries []string, err error) {
 	var db = regexp.MustCompile("(?s)Database: ([[:print:]]+)")
 	var comment = regexp.MustCompile("/\\*.*?\\*/")
 	var commentLine = regexp.MustCompile("(?s)--.*?\n")
 
-	reg := db.FindAllStringSubmatch(data, -1)
+	reg := db.FindAllStringSubmatch(dump, -1)
 
 	var database string
 	if len(reg) > 0 && len(reg[0]) > 1 {
 		database = reg[0][1]
 	}
 
-	data = comment.ReplaceAllString(data, ``)
-	data = commentLine.ReplaceAllString(data, ``)
+	dump = comment.ReplaceAllString(dump, ``)
+	dump = commentLine.ReplaceAllString(dump, ``)
 
-	sqlsInFile := strings.Split(data, ";\n")
+	sqlsInFile := strings.Split(dump, ";\n")
 
 	var sqlsPurify []string
 	for _, sql := range sqlsInFile {
@@ -524,10 +654,10 @@ func dumpAdopt(data string) (queries []string, err error) {
 		}
 	}
 
-	dest := new(vertica.Cache)
+	dest := vertica.New(data.Destination)
 	for _, sql := range sqlsPurify {
 		var vsql []string
-		switch ddl := ddlparser.Ddlcase(sql, database).(type) {
+		switch ddl := src.applyDDLRules(ddlparser.Ddlcase(sql, database)).(type) {
 		case isql.CreateTable:
 			vsql = dest.GetTableSQL(ddl)
 		case []isql.DropTable:
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -292,12 +293,12 @@ func (s *EventsTestSuite) TestConfigTablesGTIDFilters() {
 func (s *EventsTestSuite) getSenderChan() <-chan interface{} {
 	s.cfg.ServerID++
 
-	sender := make(chan interface{})
+	sender := newEventQueue(1)
 	cancel := make(chan configSource)
 
-	go listenSource(s.cfg, sender, cancel)
+	go listenSource(context.Background(), s.cfg, sender, cancel)
 
-	return sender
+	return sender.events
 }
 
 func (s *EventsTestSuite) AddTx(sql string) {
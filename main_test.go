@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/b13f/repligator/vertica"
 )
 
 //docker run -d -p 3306:3306 --name mysql -e MYSQL_ALLOW_EMPTY_PASSWORD=yes percona/percona-server:latest --binlog_format=ROW --binlog_row_image=full --server-id=1 --log-bin=/tmp/bin.log --gtid-mode=ON --enforce-gtid-consistency
@@ -27,3 +37,374 @@ func TestGetGtidSetCase(t *testing.T) {
 		t.Logf("\n%v\n", gtidHash)
 	}
 }
+
+func TestMapTable(t *testing.T) {
+	rules := []configMapping{
+		{Schema: `shard1`, Table: `orders`, ToSchema: `sales`},
+		{Schema: `shard2`, Table: `orders`, ToSchema: `sales`},
+		{Schema: `app`, ToSchema: `app_mysql`},
+		{Schema: `app`, Table: `users`, ToTable: `app_users`},
+	}
+
+	assert.Equal(t, isql.Table{Schema: `sales`, Name: `orders`}, mapTable(rules, isql.Table{Schema: `shard1`, Name: `orders`}))
+	assert.Equal(t, isql.Table{Schema: `sales`, Name: `orders`}, mapTable(rules, isql.Table{Schema: `shard2`, Name: `orders`}))
+	assert.Equal(t, isql.Table{Schema: `shard2`, Name: `items`}, mapTable(rules, isql.Table{Schema: `shard2`, Name: `items`}))
+	assert.Equal(t, isql.Table{Schema: `app_mysql`, Name: `items`}, mapTable(rules, isql.Table{Schema: `app`, Name: `items`}))
+	assert.Equal(t, isql.Table{Schema: `app`, Name: `app_users`}, mapTable(rules, isql.Table{Schema: `app`, Name: `users`}))
+
+	assert.Equal(t, isql.CreateSchema{Name: `app_mysql`}, mapDDL(rules, isql.CreateSchema{Name: `app`}))
+	assert.Equal(t, []isql.RenameTable{{From: isql.Table{Schema: `sales`, Name: `orders`}, To: isql.Table{Schema: `shard1`, Name: `orders_old`}}},
+		mapDDL(rules, []isql.RenameTable{{From: isql.Table{Schema: `shard1`, Name: `orders`}, To: isql.Table{Schema: `shard1`, Name: `orders_old`}}}))
+
+	sources := []configSource{
+		{Name: `shard1`, Schemas: []configSourceSchema{{Name: `shard1`}}, Mapping: rules[:1]},
+		{Name: `shard2`, Schemas: []configSourceSchema{{Name: `shard2`}, {Name: `app`}}, Mapping: rules[1:]},
+	}
+
+	assert.True(t, isMergeTarget(sources, isql.Table{Schema: `sales`, Name: `orders`}))
+	assert.False(t, isMergeTarget(sources, isql.Table{Schema: `app_mysql`, Name: `orders`}))
+
+	//rules of one source are not merge, source without mapping writes same table
+	sources = []configSource{{Name: `shard1`, Schemas: []configSourceSchema{{Name: `shard1`}, {Name: `shard2`}}, Mapping: rules[:2]}}
+	assert.False(t, isMergeTarget(sources, isql.Table{Schema: `sales`, Name: `orders`}))
+
+	sources = append(sources, configSource{Name: `sales`, Schemas: []configSourceSchema{{Name: `sales`}}})
+	assert.True(t, isMergeTarget(sources, isql.Table{Schema: `sales`, Name: `orders`}))
+	assert.False(t, isMergeTarget(sources, isql.Table{Schema: `shard1`, Name: `orders`}))
+
+	//tables not read by source are not written by it, same predicate as listenSource
+	sources[1].Schemas[0].TablesExclude = []string{`orders`}
+	assert.False(t, sources[1].replicatesTable(isql.Table{Schema: `sales`, Name: `orders`}))
+	assert.False(t, isMergeTarget(sources, isql.Table{Schema: `sales`, Name: `orders`}))
+
+	sources[0].Schemas = []configSourceSchema{{Name: `app`}}
+	assert.False(t, sources[0].writesTable(isql.Table{Schema: `sales`, Name: `orders`}))
+	assert.True(t, configSource{}.replicatesTable(isql.Table{Schema: `sales`, Name: `orders`}))
+}
+
+func TestColumnRules(t *testing.T) {
+	src := configSource{Schemas: []configSourceSchema{{Name: `app`, Tables: []configSourceTable{
+		{Name: `users`, Columns: map[string]string{`Email`: columnHash, `phone`: columnDrop, `name`: columnNull}},
+	}}}}
+
+	rules := src.columnRules(isql.Table{Schema: `app`, Name: `users`})
+	row := maskRow(rules, []string{`id`, `email`, `PHONE`, `name`}, `salt`, []interface{}{int64(1), `a@b.c`, `555`, `John`})
+
+	assert.Equal(t, []interface{}{int64(1), hashValue(`salt`, `a@b.c`), nil}, row)
+	assert.Equal(t, hashValue(`salt`, []byte(`a@b.c`)), hashValue(`salt`, `a@b.c`))
+	assert.NotEqual(t, hashValue(`pepper`, `a@b.c`), hashValue(`salt`, `a@b.c`))
+	assert.Nil(t, hashValue(`salt`, nil))
+
+	//binlog of table before alter
+	table := isql.Table{Schema: `app`, Name: `users`}
+	assert.NoError(t, checkColumns(table, []string{`id`, `email`}, 2))
+	assert.NoError(t, checkColumns(table, []string{`id`, `email`}, 0))
+	assert.EqualError(t, checkColumns(table, []string{`id`, `email`}, 3), `columns of app.users unknown: binlog row has 3 columns, known table has 2`)
+
+	assert.Equal(t, isql.CreateTable{
+		Table:       isql.Table{Schema: `app`, Name: `users`},
+		Columns:     []isql.Column{{Name: `id`, Type: `int(11)`}, {Name: `email`, Type: hashColumnType}, {Name: `name`, Type: `varchar(20)`}},
+		Constraints: []isql.Constraint{{Type: isql.Primary, Columns: []string{`id`}}},
+	}, src.applyDDLRules(isql.CreateTable{
+		Table:   isql.Table{Schema: `app`, Name: `users`},
+		Columns: []isql.Column{{Name: `id`, Type: `int(11)`}, {Name: `email`, Type: `varchar(50)`}, {Name: `phone`, Type: `varchar(20)`}, {Name: `name`, Type: `varchar(20)`}},
+		Constraints: []isql.Constraint{
+			{Type: isql.Primary, Columns: []string{`id`}},
+			{Type: isql.Unique, Columns: []string{`phone(10)`}},
+		},
+	}))
+}
+
+func TestTrackColumns(t *testing.T) {
+	table := isql.Table{Schema: `app`, Name: `users`}
+	meta, _ := newSourceMeta(configSource{Name: `track`, Schemas: []configSourceSchema{{Name: `app`, Tables: []configSourceTable{
+		{Name: `users`, Columns: map[string]string{`email`: columnDrop}},
+	}}}})
+
+	meta.trackDDL(`app`, "CREATE TABLE users (id INT, email VARCHAR(50), PRIMARY KEY (id))")
+	assert.Equal(t, []string{`id`, `email`}, meta.columns[table])
+
+	//columns follow ddl at its binlog position
+	meta.trackDDL(`app`, "ALTER TABLE users ADD COLUMN name VARCHAR(20), DROP COLUMN `Email`, ADD COLUMN id INT")
+	assert.Equal(t, []string{`id`, `name`}, meta.columns[table])
+
+	meta.trackDDL(`app`, "ALTER TABLE users ADD COLUMN email VARCHAR(50)")
+	rowEv, err := meta.applyRules(isql.TableRowsEvent{Table: table, ColumnCount: 3, Rows: []isql.Rows{{Type: isql.Insert, Values: [][]interface{}{{1, `John`, `a@b.c`}}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{1, `John`}}, rowEv.GetRows()[0].GetValues())
+
+	meta.trackDDL(`app`, "RENAME TABLE users TO accounts")
+	assert.Equal(t, []string{`id`, `name`, `email`}, meta.columns[isql.Table{Schema: `app`, Name: `accounts`}])
+	meta.trackDDL(`app`, "RENAME TABLE accounts TO users")
+
+	//rows of table with unknown columns are dropped, rules not applied to wrong positions
+	meta.trackDDL(`app`, "ALTER TABLE users CHANGE email mail VARCHAR(50)")
+	rowEv, err = meta.applyRules(isql.TableRowsEvent{Table: table, ColumnCount: 3, Rows: []isql.Rows{{Type: isql.Insert, Values: [][]interface{}{{1, `a@b.c`, `John`}}}}})
+	assert.NoError(t, err)
+	assert.Empty(t, rowEv.GetRows())
+
+	//other version of table than known one
+	meta.trackDDL(`app`, "DROP TABLE users")
+	meta.trackDDL(`app`, "CREATE TABLE users (id INT, email VARCHAR(50))")
+	rowEv, err = meta.applyRules(isql.TableRowsEvent{Table: table, ColumnCount: 3, Rows: []isql.Rows{{Type: isql.Insert, Values: [][]interface{}{{1, `a@b.c`, `John`}}}}})
+	assert.NoError(t, err)
+	assert.Empty(t, rowEv.GetRows())
+}
+
+func TestDumpSource(t *testing.T) {
+	sources := data.Sources
+	defer func() { data.Sources = sources }()
+
+	data.Sources = []configSource{{Name: `shard1`}}
+	src, err := getDumpSource(``)
+	assert.NoError(t, err)
+	assert.Equal(t, `shard1`, src.Name)
+
+	data.Sources = append(data.Sources, configSource{Name: `shard2`})
+	_, err = getDumpSource(``)
+	assert.EqualError(t, err, `config has 2 sources, set source of dump with -ds`)
+
+	src, err = getDumpSource(`shard2`)
+	assert.NoError(t, err)
+	assert.Equal(t, `shard2`, src.Name)
+
+	_, err = getDumpSource(`shard3`)
+	assert.Error(t, err)
+}
+
+func TestRowFilter(t *testing.T) {
+	filter, err := parseFilter(`tenant_id IN (1,2,3) AND (status != 'draft' OR status IS NULL) AND NOT amount < -1.5`)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	columns := map[string]int{`tenant_id`: 0, `status`: 1, `amount`: 2}
+
+	assert.True(t, filter.match(columns, []interface{}{int64(2), `new`, 10.5}))
+	assert.True(t, filter.match(columns, []interface{}{int32(3), nil, `0`}))
+	assert.False(t, filter.match(columns, []interface{}{int64(4), `new`, 10.5}))
+	assert.False(t, filter.match(columns, []interface{}{int64(1), []byte(`draft`), 10.5}))
+	assert.False(t, filter.match(columns, []interface{}{int64(1), `new`, -2}))
+
+	filter, err = parseFilter(`id = 9007199254740993 AND amount > -.5`)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	columns = map[string]int{`id`: 0, `amount`: 1}
+
+	assert.True(t, filter.match(columns, []interface{}{uint64(9007199254740993), 0}))
+	assert.False(t, filter.match(columns, []interface{}{int64(9007199254740992), 0}))
+	assert.False(t, filter.match(columns, []interface{}{uint64(9007199254740993), -1}))
+	assert.Equal(t, 1, compareValue(uint64(18446744073709551615), filterToken{kind: tokenNumber, value: `-1`}))
+
+	for _, expr := range []string{`tenant_id IN (1,2`, `status = 'draft`, `status ! 1`, `status IS 1`, `AND status = 1`, `status = 1 status`,
+		`amount = -`, `amount = .`, `amount = a-b`, `amount = a-1`} {
+		_, err = parseFilter(expr)
+		assert.Error(t, err, expr)
+	}
+
+	table := isql.Table{Schema: `app`, Name: `orders`}
+	meta, err := newSourceMeta(configSource{Schemas: []configSourceSchema{{Name: `app`, Tables: []configSourceTable{{Name: `orders`, Filter: `status != 'draft'`}}}}})
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	meta.columns[table] = []string{`id`, `status`}
+
+	rowEv, err := meta.filterRows(isql.TableRowsEvent{Table: table, Rows: []isql.Rows{
+		{Type: isql.Insert, Values: [][]interface{}{{1, `draft`}, {2, `new`}}},
+		{Type: isql.Update, Values: [][]interface{}{{1, `draft`}, {1, `new`}, {2, `new`}, {2, `draft`}, {3, `new`}, {3, `paid`}, {4, `draft`}, {4, `draft`}}},
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []isql.Rows{
+		{Type: isql.Insert, Values: [][]interface{}{{2, `new`}}},
+		{Type: isql.Delete, Values: [][]interface{}{{2, `new`}}},
+		{Type: isql.Update, Values: [][]interface{}{{3, `new`}, {3, `paid`}}},
+		{Type: isql.Insert, Values: [][]interface{}{{1, `new`}}},
+	}, rowEv.GetRows())
+
+	//filter columns are case insensitive, unknown column stops source
+	filter, _ = parseFilter(`Status = 'new'`)
+	assert.NoError(t, filter.check(map[string]int{`status`: 1}))
+	meta.filters[table], _ = parseFilter(`state != 'draft'`)
+
+	_, err = meta.filterRows(isql.TableRowsEvent{Table: table, Rows: []isql.Rows{{Type: isql.Insert, Values: [][]interface{}{{1, `draft`}}}}})
+	assert.EqualError(t, err, `filter for app.orders: filter column state not found in table`)
+}
+
+func TestEventQueue(t *testing.T) {
+	queue := newEventQueue(1)
+
+	assert.True(t, queue.send(context.Background(), `shard1`, 1))
+	assert.Equal(t, "queue: 1 of 1\n", queue.info())
+
+	sent := make(chan bool)
+	go func() {
+		sent <- queue.send(context.Background(), `shard1`, 2)
+	}()
+
+	assert.Equal(t, 1, <-queue.events)
+	assert.True(t, <-sent)
+	assert.Equal(t, 2, <-queue.events)
+
+	//stopped source does not wait for full queue
+	assert.True(t, queue.send(context.Background(), `shard1`, 3))
+	stop, cancel := context.WithCancel(context.Background())
+	go cancel()
+	assert.False(t, queue.send(stop, `shard1`, 4))
+	assert.Equal(t, 3, <-queue.events)
+
+	queue.Lock()
+	assert.Equal(t, 0, queue.paused[`shard1`])
+	queue.Unlock()
+}
+
+func TestStatusAPI(t *testing.T) {
+	queue := newEventQueue(10)
+	handlers := getAPIHandlers(vertica.New(vertica.Config{}), queue)
+
+	sourcesState.setState(`api_test`, sourceConnected, nil)
+	sourcesState.setGtid(`api_test`, `uuid:1-5`)
+	sourcesState.setEvent(`api_test`, 1)
+
+	w := httptest.NewRecorder()
+	handlers[`/api/v1/status`](w, httptest.NewRequest(`GET`, `/api/v1/status`, nil))
+
+	var status apiStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, `v1`, status.Version)
+	assert.Equal(t, 10, status.Queue.Capacity)
+	assert.Empty(t, status.Destination.Tables)
+
+	var source sourceStatus
+	for _, s := range status.Sources {
+		if s.Name == `api_test` {
+			source = s
+		}
+	}
+
+	assert.Equal(t, sourceConnected, source.State)
+	assert.Equal(t, `uuid:1-5`, source.Gtid)
+	assert.True(t, source.Lag > 0)
+
+	//full queue is reported as waiting, not paused
+	queue.paused[`api_test`]++
+	for _, s := range sourcesState.list(queue) {
+		if s.Name == `api_test` {
+			assert.Equal(t, sourceWaiting, s.State)
+		}
+	}
+	queue.paused[`api_test`]--
+
+	w = httptest.NewRecorder()
+	handlers[`/api/v1/tables`](w, httptest.NewRequest(`GET`, `/api/v1/tables`, nil))
+	assert.Equal(t, "[]\n", w.Body.String())
+
+	//replace reports applied statements and that they are not rolled back
+	w = httptest.NewRecorder()
+	handlers[`/api/v1/ddl/replace`](w, httptest.NewRequest(`POST`, `/api/v1/ddl/replace?gtid=uuid:7`, strings.NewReader(``)))
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, `{"ok":false,"error":"vsql required for replace","applied":0,"total":0,"warning":"`+replaceWarning+`"}`+"\n", w.Body.String())
+}
+
+func TestMetrics(t *testing.T) {
+	sourcesState.setEvent(`metrics_test`, 1)
+	sourceReconnects.WithLabelValues(`metrics_test`).Inc()
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(`GET`, `/metrics`, nil))
+
+	assert.True(t, strings.Contains(w.Body.String(), `repligator_replication_lag_seconds{source="metrics_test"}`))
+	assert.True(t, strings.Contains(w.Body.String(), `repligator_source_reconnects_total{source="metrics_test"} 1`))
+	assert.True(t, strings.Contains(w.Body.String(), `repligator_flush_duration_seconds_count 0`))
+}
+
+func TestHeartbeatTable(t *testing.T) {
+	src := configSource{Heartbeat: 10, HeartbeatSchema: `repligator`}
+
+	assert.True(t, src.isHeartbeatTable(isql.Table{Schema: `repligator`, Name: isql.HeartbeatTable}))
+	assert.False(t, src.isHeartbeatTable(isql.Table{Schema: `app`, Name: isql.HeartbeatTable}))
+
+	src.Heartbeat = 0
+	assert.False(t, src.isHeartbeatTable(isql.Table{Schema: `repligator`, Name: isql.HeartbeatTable}))
+}
+
+func TestHealth(t *testing.T) {
+	receiver := vertica.New(vertica.Config{})
+	now := time.Now()
+
+	assert.Len(t, checkLoop(receiver, now, time.Minute), 1)
+
+	receiver.ApplyEvent(make(chan interface{}))
+	assert.Empty(t, checkLoop(receiver, now, time.Minute))
+
+	sourcesState.setState(`health_ok`, sourceConnected, nil)
+	sourcesState.setState(`health_retry`, sourceReconnecting, nil)
+	sourcesState.setState(`health_stopped`, sourceStopped, nil)
+	sourcesState.setState(`health_connecting`, sourceConnecting, nil)
+
+	sources := []configSource{{Name: `health_ok`}, {Name: `health_retry`, TryAfter: 1}, {Name: `health_stopped`}, {Name: `health_missing`}, {Name: `health_connecting`, TryAfter: 1}}
+
+	assert.Equal(t, []string{`source health_stopped stopped`, `source health_missing not started`}, checkSources(sources, now))
+	assert.Len(t, checkSources(sources, now.Add(time.Hour)), 4)
+
+	//retries keep time of first failed connect until source connects
+	status, _ := sourcesState.get(`health_retry`)
+	failing := *status.FailingSince
+	sourcesState.setState(`health_retry`, sourceConnecting, nil)
+	sourcesState.setState(`health_retry`, sourceReconnecting, nil)
+	status, _ = sourcesState.get(`health_retry`)
+	assert.Equal(t, failing, *status.FailingSince)
+
+	sourcesState.setState(`health_retry`, sourceConnected, nil)
+	status, _ = sourcesState.get(`health_retry`)
+	assert.Nil(t, status.FailingSince)
+
+	w := httptest.NewRecorder()
+	getHealthHandlers(receiver, nil, 0)[`/readyz`](w, httptest.NewRequest(`GET`, `/readyz`, nil))
+
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, "{\"ok\":false,\"reasons\":[\"destination not reachable: not connected\"]}\n", w.Body.String())
+}
+
+func TestPauseSource(t *testing.T) {
+	receiver := vertica.New(vertica.Config{})
+	queue := newEventQueue(1)
+	receiver.ApplyEvent(queue.events)
+
+	sources := newSourceControl(context.Background(), queue, receiver)
+	sources.configs[`pause_test`] = configSource{Name: `pause_test`}
+
+	assert.NoError(t, sources.Pause(`pause_test`))
+	assert.Equal(t, []string{`pause_test`}, sources.Paused())
+	assert.Error(t, sources.Pause(`pause_test`))
+	assert.Error(t, sources.Pause(`missing`))
+	assert.Error(t, sources.Resume(`missing`))
+
+	status, _ := sourcesState.get(`pause_test`)
+	assert.Equal(t, sourcePaused, status.State)
+}
+
+func TestPauseSourceTimeout(t *testing.T) {
+	timeout := pauseFlushTimeout
+	pauseFlushTimeout = 10 * time.Millisecond
+	defer func() { pauseFlushTimeout = timeout }()
+
+	//apply loop does not read queue
+	sources := newSourceControl(context.Background(), newEventQueue(1), vertica.New(vertica.Config{}))
+	sources.configs[`pause_timeout`] = configSource{Name: `pause_timeout`}
+
+	assert.EqualError(t, sources.Pause(`pause_timeout`), `source pause_timeout paused, flush not done in 10ms`)
+	assert.Equal(t, []string{`pause_timeout`}, sources.Paused())
+
+	//reader blocked not longer than timeout
+	sources.configs[`pause_stuck`] = configSource{Name: `pause_stuck`}
+	sources.running[`pause_stuck`] = runningSource{cancel: func() {}, done: make(chan struct{})}
+
+	assert.EqualError(t, sources.Pause(`pause_stuck`), `source pause_stuck paused, reader not stopped in 10ms`)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"github.com/b13f/repligator/ddlparser"
+	"github.com/b13f/repligator/isql"
+)
+
+type configMapping struct {
+	Schema   string
+	Table    string
+	ToSchema string `yaml:"to_schema"`
+	ToTable  string `yaml:"to_table"`
+}
+
+//return destination schema of rule
+func (m configMapping) targetSchema() string {
+	if len(m.ToSchema) > 0 {
+		return m.ToSchema
+	}
+	return m.Schema
+}
+
+//return destination table of rule, empty for all tables in schema
+func (m configMapping) targetTable() string {
+	if len(m.ToTable) > 0 {
+		return m.ToTable
+	}
+	return m.Table
+}
+
+//return destination table for source table, table rules first
+func mapTable(rules []configMapping, table isql.Table) isql.Table {
+	for _, rule := range rules {
+		if rule.Schema == table.GetSchema() && len(rule.Table) > 0 && rule.Table == table.GetName() {
+			return isql.Table{Schema: rule.targetSchema(), Name: rule.targetTable()}
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.Schema == table.GetSchema() && len(rule.Table) == 0 {
+			name := table.GetName()
+			if len(rule.ToTable) > 0 {
+				name = rule.ToTable
+			}
+			return isql.Table{Schema: rule.targetSchema(), Name: name}
+		}
+	}
+
+	return table
+}
+
+//return destination schema for source schema, only schema rules used
+func mapSchema(rules []configMapping, schema string) string {
+	for _, rule := range rules {
+		if rule.Schema == schema && len(rule.Table) == 0 && len(rule.ToTable) == 0 {
+			return rule.targetSchema()
+		}
+	}
+
+	return schema
+}
+
+//rewrite tables of parsed ddl
+func mapDDL(rules []configMapping, ddl interface{}) interface{} {
+	switch t := ddl.(type) {
+	case isql.CreateSchema:
+		t.Name = mapSchema(rules, t.GetName())
+		return t
+	case isql.CreateTable:
+		t.Table = mapTable(rules, t.GetCreateTable())
+		return t
+	case isql.CreateTableLike:
+		t.Table = mapTable(rules, t.GetTable())
+		t.LikeTable = mapTable(rules, t.GetLikeTable())
+		return t
+	case []isql.RenameTable:
+		renames := make([]isql.RenameTable, 0, len(t))
+		for _, r := range t {
+			renames = append(renames, isql.RenameTable{From: mapTable(rules, r.GetFrom()), To: mapTable(rules, r.GetTo())})
+		}
+		return renames
+	case isql.AlterTable:
+		t.Table = mapTable(rules, t.GetAlterTable())
+		return t
+	case isql.TruncateTable:
+		t.Table = mapTable(rules, t.Table)
+		return t
+	case []isql.DropTable:
+		drops := make([]isql.DropTable, 0, len(t))
+		for _, d := range t {
+			drops = append(drops, isql.DropTable{Table: mapTable(rules, d.Table)})
+		}
+		return drops
+	}
+
+	return ddl
+}
+
+//return tables changed by ddl
+func ddlTables(ddl interface{}) (tables []isql.Table) {
+	switch t := ddl.(type) {
+	case isql.CreateTable:
+		tables = append(tables, t.GetCreateTable())
+	case isql.CreateTableLike:
+		tables = append(tables, t.GetTable())
+	case []isql.RenameTable:
+		for _, r := range t {
+			tables = append(tables, r.GetFrom(), r.GetTo())
+		}
+	case isql.AlterTable:
+		tables = append(tables, t.GetAlterTable())
+	case isql.TruncateTable:
+		tables = append(tables, t.Table)
+	case []isql.DropTable:
+		for _, d := range t {
+			tables = append(tables, d.Table)
+		}
+	}
+
+	return
+}
+
+//check destination table is filled by more then one source
+func isMergeTarget(sources []configSource, table isql.Table) bool {
+	var sourcesCnt int
+
+	for _, src := range sources {
+		if src.writesTable(table) {
+			sourcesCnt++
+		}
+	}
+
+	return sourcesCnt > 1
+}
+
+//check some tables replicated by source are written to destination table
+func (src configSource) writesTable(table isql.Table) bool {
+	for _, rule := range src.Mapping {
+		if rule.targetSchema() != table.GetSchema() {
+			continue
+		}
+
+		switch {
+		case len(rule.Table) > 0:
+			if rule.targetTable() == table.GetName() && src.replicatesTable(isql.Table{Schema: rule.Schema, Name: rule.Table}) {
+				return true
+			}
+		case len(rule.ToTable) > 0:
+			if rule.ToTable == table.GetName() && src.replicatesSchema(rule.Schema) {
+				return true
+			}
+		default:
+			if src.replicatesTable(isql.Table{Schema: rule.Schema, Name: table.GetName()}) {
+				return true
+			}
+		}
+	}
+
+	//table of same name not mapped away
+	if mapTable(src.Mapping, table) != table {
+		return false
+	}
+
+	return src.replicatesTable(table)
+}
+
+//check source table is read by listenSource, source without schemas replicates all tables
+func (src configSource) replicatesTable(table isql.Table) bool {
+	if len(src.Schemas) == 0 {
+		return true
+	}
+
+	for _, schema := range src.Schemas {
+		if schema.Name == table.GetSchema() && schema.hasTable(table.GetName()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//check some tables of schema are read by listenSource
+func (src configSource) replicatesSchema(name string) bool {
+	if len(src.Schemas) == 0 {
+		return true
+	}
+
+	for _, schema := range src.Schemas {
+		if schema.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+//check table of schema is replicated, sync list has priority over exclude list
+func (schema configSourceSchema) hasTable(name string) bool {
+	if len(schema.TablesSync) > 0 {
+		return contains(schema.TablesSync, name)
+	}
+
+	if len(schema.TablesExclude) > 0 {
+		return !contains(schema.TablesExclude, name)
+	}
+
+	return true
+}
+
+//return ddl event with tables rewritten by source mapping and column rules
+func getDdlEvent(src configSource, schema, query, gtidSet string) isql.DdlEvent {
+	event := isql.DdlEvent{
+		SourceName: src.Name,
+		Schema:     schema,
+		Query:      query,
+		GtidSet:    gtidSet,
+	}
+
+	parsed := ddlparser.Ddlcase(query, schema)
+
+	if len(src.Mapping) > 0 || src.hasColumnRules() {
+		event.Ddl = mapDDL(src.Mapping, src.applyDDLRules(parsed))
+		parsed = event.Ddl
+	}
+
+	for _, table := range ddlTables(parsed) {
+		if isMergeTarget(data.Sources, table) {
+			event.Merge = true
+		}
+	}
+
+	return event
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repligator_events_received_total",
+		Help: "Events sent by source to destination by type.",
+	}, []string{"source", "type"})
+
+	replicationLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "repligator_replication_lag_seconds",
+		Help: "Seconds between binlog event timestamp and its read.",
+	}, []string{"source"})
+
+	sourceReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repligator_source_reconnects_total",
+		Help: "Reconnects to source after errors.",
+	}, []string{"source"})
+
+	rowsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repligator_rows_dropped_total",
+		Help: "Rows not written because columns of their table are unknown.",
+	}, []string{"source"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsReceived, replicationLag, sourceReconnects, rowsDropped)
+}
+
+//register occupancy metrics of events queue
+func registerQueueMetrics(queue *eventQueue) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "repligator_queue_events",
+		Help: "Events waiting in queue to destination.",
+	}, func() float64 {
+		return float64(len(queue.events))
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "repligator_queue_capacity",
+		Help: "Capacity of queue to destination.",
+	}, func() float64 {
+		return float64(cap(queue.events))
+	}))
+}
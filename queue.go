@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const defaultQueueSize = 1000
+
+//bounded queue of events from sources to destination, full queue pauses source reads
+type eventQueue struct {
+	sync.Mutex
+	events chan interface{}
+	paused map[string]int           //source name to sends waiting for free place
+	pauses map[string]int           //source name to count of pauses
+	waited map[string]time.Duration //source name to time paused
+}
+
+func newEventQueue(size int) *eventQueue {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	return &eventQueue{
+		events: make(chan interface{}, size),
+		paused: make(map[string]int),
+		pauses: make(map[string]int),
+		waited: make(map[string]time.Duration),
+	}
+}
+
+//put event in queue, wait for free place if queue is full, false if source stopped while waiting
+func (q *eventQueue) send(ctx context.Context, source string, event interface{}) bool {
+	select {
+	case q.events <- event:
+		return true
+	default:
+	}
+
+	log.Debugf("Queue is full (%d), source %s paused", cap(q.events), source)
+
+	q.Lock()
+	q.paused[source]++
+	q.pauses[source]++
+	q.Unlock()
+
+	start := time.Now()
+
+	defer func() {
+		q.Lock()
+		q.paused[source]--
+		q.waited[source] += time.Since(start)
+		q.Unlock()
+	}()
+
+	select {
+	case q.events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+//return queue occupancy and pauses of sources
+func (q *eventQueue) info() string {
+	q.Lock()
+	defer q.Unlock()
+
+	out := fmt.Sprintf("queue: %d of %d\n", len(q.events), cap(q.events))
+
+	for name, pauses := range q.pauses {
+		out += fmt.Sprintf("source: %s paused: %t pauses: %d waited: %v\n", name, q.paused[name] > 0, pauses, q.waited[name])
+	}
+
+	return out
+}
+
+//check source waits for free place
+func (q *eventQueue) isWaiting(source string) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.paused[source] > 0
+}
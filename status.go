@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//source connection states
+const (
+	sourceConnecting   = "connecting"
+	sourceConnected    = "connected"
+	sourcePaused       = "paused"
+	sourceWaiting      = "waiting"
+	sourceReconnecting = "reconnecting"
+	sourceStopped      = "stopped"
+)
+
+type sourceStatus struct {
+	Name         string     `json:"name"`
+	State        string     `json:"state"`
+	Since        time.Time  `json:"since"`                   //time of state change
+	FailingSince *time.Time `json:"failing_since,omitempty"` //first connect attempt after last successful connect
+	Gtid         string     `json:"gtid"`
+	LastEvent    *time.Time `json:"last_event"`
+	EventTime    *time.Time `json:"event_time"` //binlog time of last event
+	Lag          float64    `json:"lag"`        //seconds between binlog event and its read
+	Error        string     `json:"error,omitempty"`
+}
+
+//states of sources reported by listenSource
+type sourcesStatus struct {
+	sync.Mutex
+	sources map[string]sourceStatus
+}
+
+var sourcesState = &sourcesStatus{sources: make(map[string]sourceStatus)}
+
+func (s *sourcesStatus) setState(name, state string, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	status := s.sources[name]
+	if status.State != state {
+		status.Since = now
+	}
+
+	//connect retries keep time of first attempt until source connects
+	switch state {
+	case sourceConnecting, sourceReconnecting:
+		if status.FailingSince == nil {
+			status.FailingSince = &now
+		}
+	default:
+		status.FailingSince = nil
+	}
+
+	status.Name = name
+	status.State = state
+	status.Error = ""
+
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	s.sources[name] = status
+}
+
+//remember read time and lag of binlog event
+func (s *sourcesStatus) setEvent(name string, timestamp uint32) {
+	if timestamp == 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	status := s.sources[name]
+	eventTime := time.Unix(int64(timestamp), 0)
+
+	status.LastEvent = &now
+	status.EventTime = &eventTime
+	status.Lag = now.Sub(eventTime).Seconds()
+	replicationLag.WithLabelValues(name).Set(status.Lag)
+
+	s.sources[name] = status
+}
+
+func (s *sourcesStatus) setGtid(name, gtid string) {
+	s.Lock()
+	defer s.Unlock()
+
+	status := s.sources[name]
+	status.Gtid = gtid
+
+	s.sources[name] = status
+}
+
+func (s *sourcesStatus) get(name string) (status sourceStatus, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	status, ok = s.sources[name]
+
+	return
+}
+
+//return states of sources ordered by name, sources waiting for place in queue
+func (s *sourcesStatus) list(queue *eventQueue) []sourceStatus {
+	s.Lock()
+	defer s.Unlock()
+
+	list := []sourceStatus{}
+
+	for _, status := range s.sources {
+		if status.State == sourceConnected && queue.isWaiting(status.Name) {
+			status.State = sourceWaiting
+		}
+
+		list = append(list, status)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
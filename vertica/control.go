@@ -0,0 +1,39 @@
+package vertica
+
+//SourceController pauses and resumes sources of replication
+type SourceController interface {
+	Pause(name string) error
+	Resume(name string) error
+	Paused() []string
+}
+
+//SetSourceController set sources control for pause and resume commands
+func (vc *Cache) SetSourceController(sources SourceController) {
+	vc.sources = sources
+}
+
+//pause or resume source, return result message
+func (vc *Cache) controlSource(command, name string) string {
+	if vc.sources == nil {
+		return `Sources control not set`
+	}
+
+	if name == "" {
+		return `Source name required`
+	}
+
+	var err error
+
+	switch command {
+	case `pause`:
+		err = vc.sources.Pause(name)
+	case `resume`:
+		err = vc.sources.Resume(name)
+	}
+
+	if err != nil {
+		return err.Error()
+	}
+
+	return `Source ` + name + ` ` + command + `d`
+}
@@ -0,0 +1,45 @@
+package vertica
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSources struct {
+	paused []string
+}
+
+func (ts *testSources) Pause(name string) error {
+	ts.paused = append(ts.paused, name)
+	return nil
+}
+
+func (ts *testSources) Resume(name string) error {
+	return fmt.Errorf(`source %s not paused`, name)
+}
+
+func (ts *testSources) Paused() []string {
+	return ts.paused
+}
+
+func TestControlSource(t *testing.T) {
+	v := New(Config{})
+	assert.Equal(t, `Sources control not set`, v.GetBotInterfaces()[`pause`](`pause shard1`))
+
+	v.SetSourceController(new(testSources))
+	bot := v.GetBotInterfaces()
+
+	assert.Equal(t, `Source shard1 paused`, bot[`pause`](`pause shard1`))
+	assert.Equal(t, `source shard1 not paused`, bot[`resume`](`resume shard1`))
+	assert.Equal(t, `Source name required`, bot[`pause`](`pause`))
+
+	w := httptest.NewRecorder()
+	v.GetHTTPInterfaces()[`/pause`](w, httptest.NewRequest(`GET`, `/pause?source=shard2`, nil))
+	assert.Equal(t, `Source shard2 paused`, w.Body.String())
+
+	assert.True(t, strings.Contains(v.GetTablesCacheInfo(false), "paused: shard1,shard2\n"))
+}
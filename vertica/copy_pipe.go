@@ -0,0 +1,69 @@
+package vertica
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+//stream csv lines into table through named pipe, no data written to disk
+func (vc *Cache) copyPipeLines(schema, table string, columns []string, pipe string, lines []string) (err error) {
+	os.Remove(pipe)
+
+	if err = syscall.Mkfifo(pipe, 0600); err != nil {
+		return
+	}
+
+	defer os.Remove(pipe)
+
+	written := make(chan error, 1)
+
+	go writePipe(pipe, lines, written)
+
+	if err = vc.copyFile(schema, table, columns, pipe); err != nil {
+		releasePipe(pipe, written)
+
+		return
+	}
+
+	return <-written
+}
+
+func writePipe(pipe string, lines []string, written chan error) {
+	//open blocks until COPY opens pipe for reading
+	f, err := os.OpenFile(pipe, os.O_WRONLY, 0)
+	if err != nil {
+		written <- err
+		return
+	}
+
+	w := bufio.NewWriter(f)
+
+	if err = writeCopyLines(w, lines); err == nil {
+		err = w.Flush()
+	}
+
+	f.Close()
+	written <- err
+}
+
+//drain pipe to release writer if COPY failed before reading it,
+//reader opened before writer sees no data, so open is repeated until writer is done,
+//pipe is removed only after that or writer blocks forever
+func releasePipe(pipe string, written chan error) {
+	for {
+		if r, err := os.OpenFile(pipe, os.O_RDONLY|syscall.O_NONBLOCK, 0); err == nil {
+			io.Copy(ioutil.Discard, r)
+			r.Close()
+		}
+
+		select {
+		case <-written:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
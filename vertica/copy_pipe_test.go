@@ -0,0 +1,41 @@
+package vertica
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleasePipe(t *testing.T) {
+	pipe := os.TempDir() + string(os.PathSeparator) + `repligator-release-test`
+	os.Remove(pipe)
+
+	if !assert.NoError(t, syscall.Mkfifo(pipe, 0600)) {
+		return
+	}
+	defer os.Remove(pipe)
+
+	//more than pipe buffer, writer blocks until reader is gone
+	lines := make([]string, 10000)
+	for i := range lines {
+		lines[i] = `"1","0123456789012345678901234567890123456789"`
+	}
+
+	written := make(chan error, 1)
+	go writePipe(pipe, lines, written)
+
+	done := make(chan bool)
+	go func() {
+		releasePipe(pipe, written)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`writer of pipe not released`)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"strconv"
 	"strings"
 
+	log "github.com/Sirupsen/logrus"
+
 	"github.com/b13f/repligator/isql"
 )
 
 var roundBrack = regexp.MustCompile(`\([0-9]+\)`)
 
+var sourceColumnType = `VARCHAR(255)`
+
 //return schema create vsql
 func (vc *Cache) getSchemaSQL(schema isql.CreateSchema) []string {
 	sqlTmpl := `CREATE SCHEMA IF NOT EXISTS "%s"`
@@ -27,6 +31,7 @@ func (vc *Cache) GetTableSQL(ddl isql.CreateTable) (sqls []string) {
 	columnTmpl := `"%s" %s,` + "\n"
 	columns := ``
 	order := ``
+	keyState := vc.getKeyState(ddl.GetCreateTable().GetSchema(), ddl.GetCreateTable().GetName())
 	//store enum values into comment
 	var enums []string
 
@@ -38,10 +43,25 @@ func (vc *Cache) GetTableSQL(ddl isql.CreateTable) (sqls []string) {
 		}
 	}
 
+	//rows of different sources in one table
+	if len(vc.sourceColumn) > 0 {
+		columns += fmt.Sprintf(columnTmpl, vc.sourceColumn, sourceColumnType)
+	}
+
+	if vc.getTableConfig(ddl.GetCreateTable().GetSchema(), ddl.GetCreateTable().GetName()).SoftDelete {
+		columns += fmt.Sprintf(columnTmpl, deletedColumn, deletedColumnType)
+		columns += fmt.Sprintf(columnTmpl, deletedAtColumn, deletedAtColumnType)
+	}
+
+	for _, name := range vc.metaColumns {
+		columns += fmt.Sprintf(columnTmpl, name, metaColumnTypes[name])
+	}
+
 	for _, key := range ddl.GetConstraints() {
 		if key.GetType() == isql.Primary {
-			columns += `PRIMARY KEY ("` + strings.Join(key.GetColumns(), `","`) + "\") ENABLED,\n"
-			order = fmt.Sprintf(`ORDER BY "%s"`, strings.Join(key.GetColumns(), `","`))
+			keyColumns := vc.withSourceColumn(key.GetColumns())
+			columns += `PRIMARY KEY ("` + strings.Join(keyColumns, `","`) + "\") " + keyState + ",\n"
+			order = fmt.Sprintf(`ORDER BY "%s"`, strings.Join(keyColumns, `","`))
 		}
 
 		if key.GetType() == isql.Unique {
@@ -49,6 +69,7 @@ func (vc *Cache) GetTableSQL(ddl isql.CreateTable) (sqls []string) {
 			for _, column := range key.GetColumns() {
 				columnsNames = append(columnsNames, roundBrack.ReplaceAllLiteralString(column, ""))
 			}
+			columnsNames = vc.withSourceColumn(columnsNames)
 
 			//when primary not exist segment projection
 			if len(order) == 0 {
@@ -56,7 +77,7 @@ func (vc *Cache) GetTableSQL(ddl isql.CreateTable) (sqls []string) {
 				order += fmt.Sprintf(sqlSegmTmpl, strings.Join(columnsNames, `","`))
 			}
 
-			columns += `UNIQUE ("` + strings.Join(columnsNames, `","`) + "\") ENABLED,\n"
+			columns += `UNIQUE ("` + strings.Join(columnsNames, `","`) + "\") " + keyState + ",\n"
 		}
 	}
 
@@ -68,9 +89,22 @@ func (vc *Cache) GetTableSQL(ddl isql.CreateTable) (sqls []string) {
 		sqls = append(sqls, setEnumSQL(ddl.GetCreateTable().GetSchema(), ddl.GetCreateTable().GetName(), enums))
 	}
 
+	if vc.getTableConfig(ddl.GetCreateTable().GetSchema(), ddl.GetCreateTable().GetName()).History {
+		sqls = append(sqls, getHistorySQL(ddl.GetCreateTable().GetSchema(), ddl.GetCreateTable().GetName()))
+	}
+
 	return
 }
 
+//add source column to key columns
+func (vc *Cache) withSourceColumn(columns []string) []string {
+	if len(vc.sourceColumn) == 0 {
+		return columns
+	}
+
+	return append(append([]string{}, columns...), vc.sourceColumn)
+}
+
 func (vc *Cache) getTableLikeSQL(ddl isql.CreateTableLike) (sqls []string) {
 	sqlTmpl := `CREATE TABLE IF NOT EXISTS "%s"."%s" LIKE "%s"."%s"`
 
@@ -87,6 +121,15 @@ func (vc *Cache) getTruncateSQL(truncate isql.TruncateTable) (vsqls []string) {
 	return
 }
 
+//delete only source rows from table filled by several sources
+func (vc *Cache) getSourceTruncateSQL(truncate isql.TruncateTable, source string) (vsqls []string) {
+	vsqlTmpl := `DELETE FROM "%s"."%s" WHERE "%s"='%s'`
+
+	vsqls = append(vsqls, fmt.Sprintf(vsqlTmpl, truncate.GetSchema(), truncate.GetName(), vc.sourceColumn, strings.Replace(source, `'`, `''`, -1)))
+
+	return
+}
+
 func (vc *Cache) getRenameSQL(renames []isql.RenameTable) (vsqls []string) {
 	//because projections not renamed and rise conflicts, create new table and drop old
 	vsqlTmplCreate := `CREATE TABLE IF NOT EXISTS "%s"."%s" AS SELECT * FROM "%s"."%s"`
@@ -116,6 +159,7 @@ func (vc *Cache) GetDropSQL(drops []isql.DropTable) (vsqls []string) {
 func (vc *Cache) getAlterSQL(ddl isql.AlterTable) (sqls []string, err error) {
 
 	alter := fmt.Sprintf(`ALTER TABLE "%s"."%s" `, ddl.GetAlterTable().GetSchema(), ddl.GetAlterTable().GetName())
+	keyState := vc.getKeyState(ddl.GetAlterTable().GetSchema(), ddl.GetAlterTable().GetName())
 
 	columnAddTmpl := `ADD COLUMN "%s" %s`
 	columnDropTmpl := `DROP COLUMN "%s" CASCADE`
@@ -124,15 +168,29 @@ func (vc *Cache) getAlterSQL(ddl isql.AlterTable) (sqls []string, err error) {
 		sqls = append(sqls, alter+fmt.Sprintf(columnDropTmpl, col.GetName()))
 	}
 
+	var addSqls []string
 	for _, col := range ddl.GetAddColumns() {
-		sqls = append(sqls, alter+fmt.Sprintf(columnAddTmpl, col.GetName(), vc.typeConvert(col.GetType())))
+		addSqls = append(addSqls, alter+fmt.Sprintf(columnAddTmpl, col.GetName(), vc.typeConvert(col.GetType())))
+	}
+	sqls = append(sqls, addSqls...)
+
+	//history table gets new columns, dropped ones keep old versions
+	if vc.getTableConfig(ddl.GetAlterTable().GetSchema(), ddl.GetAlterTable().GetName()).History && len(sqls) > 0 {
+		historyAlter := fmt.Sprintf(`ALTER TABLE "%s"."%s" `, ddl.GetAlterTable().GetSchema(), ddl.GetAlterTable().GetName()+historySuffix)
+		historySqls := []string{getHistorySQL(ddl.GetAlterTable().GetSchema(), ddl.GetAlterTable().GetName())}
+
+		for _, vsql := range addSqls {
+			historySqls = append(historySqls, strings.Replace(vsql, alter, historyAlter, 1))
+		}
+
+		sqls = append(historySqls, sqls...)
 	}
 
 	vc.tables = make(map[string]tableCache)
 
 	for _, key := range ddl.GetAddConstraints() {
 		if key.GetType() == isql.Primary {
-			sqls = append(sqls, alter+`ADD PRIMARY KEY ("`+strings.Join(key.GetColumns(), `","`)+`") ENABLED`)
+			sqls = append(sqls, alter+`ADD PRIMARY KEY ("`+strings.Join(vc.withSourceColumn(key.GetColumns()), `","`)+`") `+keyState)
 		}
 
 		if key.GetType() == isql.Unique {
@@ -140,8 +198,9 @@ func (vc *Cache) getAlterSQL(ddl isql.AlterTable) (sqls []string, err error) {
 			for _, column := range key.GetColumns() {
 				columnsNames = append(columnsNames, roundBrack.ReplaceAllLiteralString(column, ""))
 			}
+			columnsNames = vc.withSourceColumn(columnsNames)
 
-			sqls = append(sqls, alter+`ADD UNIQUE ("`+strings.Join(columnsNames, `","`)+`") ENABLED`)
+			sqls = append(sqls, alter+`ADD UNIQUE ("`+strings.Join(columnsNames, `","`)+`") `+keyState)
 		}
 	}
 
@@ -286,3 +345,64 @@ func (vc *Cache) typeConvert(mysql string) (vsql string) {
 
 	return
 }
+
+//return ddl safe for table filled by several sources
+func (vc *Cache) mergeDDL(ddl interface{}) (merged interface{}, err error) {
+	switch t := ddl.(type) {
+	case isql.TruncateTable:
+		//only source rows will be deleted
+		if len(vc.sourceColumn) > 0 {
+			return ddl, nil
+		}
+		log.Warnf("DDL skipped for merged table: %+v", t)
+		return nil, nil
+	case []isql.RenameTable, []isql.DropTable:
+		//data of other sources will be lost
+		log.Warnf("DDL skipped for merged table: %+v", t)
+		return nil, nil
+	case isql.AlterTable:
+		//other changes can not be reconciled between sources
+		if len(t.GetAddColumns())+len(t.GetDropColumns())+len(t.GetAddConstraints()) == 0 {
+			return nil, fmt.Errorf(`ALTER of merged table %s.%s has no column or key changes`, t.GetAlterTable().GetSchema(), t.GetAlterTable().GetName())
+		}
+
+		alter, err := vc.mergeAlter(t)
+		if err != nil || len(alter.GetAddColumns())+len(alter.GetDropColumns())+len(alter.GetAddConstraints()) == 0 {
+			return nil, err
+		}
+		return alter, nil
+	}
+
+	return ddl, nil
+}
+
+//remove from alter changes already done by other sources
+func (vc *Cache) mergeAlter(ddl isql.AlterTable) (merged isql.AlterTable, err error) {
+	tableInfo, err := vc.newVerticaTableCache(ddl.GetAlterTable().GetSchema(), ddl.GetAlterTable().GetName())
+
+	if err != nil {
+		return
+	}
+
+	merged.Table = ddl.GetAlterTable()
+
+	for _, col := range ddl.GetAddColumns() {
+		if !tableInfo.hasColumn(col.GetName()) {
+			merged.AddColumns = append(merged.AddColumns, col)
+		}
+	}
+
+	for _, col := range ddl.GetDropColumns() {
+		if tableInfo.hasColumn(col.GetName()) {
+			merged.DropColumns = append(merged.DropColumns, col)
+		}
+	}
+
+	for _, key := range ddl.GetAddConstraints() {
+		if !tableInfo.hasConstraint(key.GetType(), vc.withSourceColumn(key.GetColumns())) {
+			merged.AddConstraints = append(merged.AddConstraints, key)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,194 @@
+package vertica
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/b13f/repligator/isql"
+)
+
+//outcomes of DDL in history table
+const (
+	ddlOutcomeApplied  = "applied"
+	ddlOutcomeSkipped  = "skipped"
+	ddlOutcomeFailed   = "failed"
+	ddlOutcomeReplaced = "replaced"
+	ddlOutcomeIgnored  = "ignored" //no vsql for DDL, table not replicated or statement not needed in Vertica
+)
+
+var ddlAuditCreateSQL = `CREATE TABLE IF NOT EXISTS public."__repligator_ddl" (name VARCHAR(1024),gtid VARCHAR(1024),query VARCHAR(65000),vsql VARCHAR(65000),outcome VARCHAR(20),error VARCHAR(65000),event_time TIMESTAMPTZ,"timestamp" TIMESTAMPTZ) ORDER BY "timestamp"`
+
+//bytes of query, vsql and error columns
+const ddlAuditTextLimit = 65000
+
+var ddlAuditInsertSQL = `INSERT INTO public."__repligator_ddl"(name,gtid,query,vsql,outcome,error,event_time,"timestamp") VALUES ('%s','%s','%s','%s','%s','%s',%s,NOW())`
+
+func quoteString(s string) string {
+	return strings.Replace(s, `'`, `''`, -1)
+}
+
+//cut string to limit of bytes on utf8 character boundary
+func truncateString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+
+	return s[:limit]
+}
+
+//return statement recording DDL outcome, long texts are truncated
+func getDDLAuditSQL(record PendingDDL, outcome string) string {
+	eventTime := `NULL`
+	if !record.EventTime.IsZero() {
+		eventTime = `'` + formatTime(record.EventTime) + `'`
+	}
+
+	return fmt.Sprintf(ddlAuditInsertSQL, quoteString(record.Source), quoteString(record.Gtid), quoteString(truncateString(record.Query, ddlAuditTextLimit)),
+		quoteString(truncateString(strings.Join(record.Vsql, ";\n"), ddlAuditTextLimit)), outcome, quoteString(truncateString(record.Error, ddlAuditTextLimit)), eventTime)
+}
+
+//record DDL which blocks replication, position is not moved
+func (vc *Cache) recordFailedDDL(record PendingDDL) {
+	if _, err := vc.forceExec(getDDLAuditSQL(record, ddlOutcomeFailed)); err != nil {
+		log.Warnf(`DDL history error: %s`, err.Error())
+	}
+}
+
+//return position and binlog times after DDL, cache position is changed only after commit
+func (vc *Cache) getDDLPosition(event isql.DdlEvent) (map[string]string, map[string]time.Time) {
+	gtidSet := make(map[string]string)
+	for name, set := range vc.gtidSet {
+		gtidSet[name] = set
+	}
+	gtidSet[event.GetSourceName()] = event.GetGtidSet()
+
+	eventTimes := make(map[string]time.Time)
+	for name, ts := range vc.eventTimes {
+		eventTimes[name] = ts
+	}
+	if event.GetTimestamp() > 0 {
+		eventTimes[event.GetSourceName()] = time.Unix(int64(event.GetTimestamp()), 0)
+	}
+
+	return gtidSet, eventTimes
+}
+
+//record DDL outcome and write position after it in one transaction
+func (vc *Cache) flushDDLPosition(event isql.DdlEvent, record PendingDDL, outcome string) (err error) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	gtidSet, eventTimes := vc.getDDLPosition(event)
+
+	if err = vc.startTx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			vc.rollbackTx()
+		}
+	}()
+
+	if _, err = vc.forceExec(getDDLAuditSQL(record, outcome)); err != nil {
+		return
+	}
+
+	if err = vc.writePosition(gtidSet, eventTimes); err != nil {
+		return
+	}
+
+	if err = vc.commitTx(); err != nil {
+		return
+	}
+
+	vc.gtidSet = gtidSet
+	vc.setEventTime(event.GetSourceName(), event.GetTimestamp())
+	vc.setCommitted(vc.eventTimes)
+
+	return
+}
+
+//replace blocked DDL by statements, return count of applied statements
+//Vertica commits DDL implicitly, so statements run one by one before transaction of substitution record and position
+func (vc *Cache) replaceDDL(event isql.DdlEvent, pending PendingDDL) (applied int, err error) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	for _, statement := range pending.Vsql {
+		if _, err = vc.forceExec(statement); err != nil {
+			return
+		}
+
+		applied++
+	}
+
+	if err = vc.startTx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			vc.rollbackTx()
+		}
+	}()
+
+	if _, err = vc.forceExec(getDDLAuditSQL(pending, ddlOutcomeReplaced)); err != nil {
+		return
+	}
+
+	//position of replaced ddl
+	gtidSet, eventTimes := vc.getDDLPosition(event)
+
+	if err = vc.writePosition(gtidSet, eventTimes); err != nil {
+		return
+	}
+
+	if err = vc.commitTx(); err != nil {
+		return
+	}
+
+	vc.gtidSet = gtidSet
+	vc.setEventTime(event.GetSourceName(), event.GetTimestamp())
+	vc.setCommitted(vc.eventTimes)
+
+	return
+}
+
+//SplitStatements split vsql statements separated by semicolon outside of quotes
+func SplitStatements(vsql string) (statements []string) {
+	var quote rune
+	start := 0
+
+	add := func(statement string) {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	for i, r := range vsql {
+		switch {
+		case quote != 0:
+			//doubled quote closes and opens again
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			add(vsql[start:i])
+			start = i + 1
+		}
+	}
+
+	add(vsql[start:])
+
+	return
+}
@@ -0,0 +1,61 @@
+package vertica
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	assert.Equal(t, []string{`ALTER TABLE a ADD COLUMN b INT`, `SELECT 1`}, SplitStatements(" ALTER TABLE a ADD COLUMN b INT;\n SELECT 1; "))
+	assert.Equal(t, []string{`COMMENT ON TABLE a IS 'x;y''s'`, `ALTER TABLE "b;c" ADD COLUMN d INT`}, SplitStatements(`COMMENT ON TABLE a IS 'x;y''s'; ALTER TABLE "b;c" ADD COLUMN d INT`))
+}
+
+func TestReplaceDDLAudit(t *testing.T) {
+	pending := PendingDDL{Source: `shard1`, Gtid: `uuid:7`, Query: `ALTER TABLE a ADD b INT COMMENT 'new'`, Error: `syntax error`,
+		Vsql: []string{`ALTER TABLE a ADD COLUMN b INT`, `SELECT 1`}}
+
+	assert.Equal(t, `INSERT INTO public."__repligator_ddl"(name,gtid,query,vsql,outcome,error,event_time,"timestamp") VALUES ('shard1','uuid:7','ALTER TABLE a ADD b INT COMMENT ''new''','ALTER TABLE a ADD COLUMN b INT;`+"\n"+`SELECT 1','replaced','syntax error',NULL,NOW())`,
+		getDDLAuditSQL(pending, ddlOutcomeReplaced))
+}
+
+func TestDDLPosition(t *testing.T) {
+	v := New(Config{})
+	v.gtidSet = map[string]string{`shard1`: `uuid:1-5`, `shard2`: `uuid2:1-3`}
+
+	gtidSet, eventTimes := v.getDDLPosition(isql.DdlEvent{SourceName: `shard1`, GtidSet: `uuid:1-6`, Timestamp: 1500000000})
+
+	//cache position changed only after commit
+	assert.Equal(t, map[string]string{`shard1`: `uuid:1-6`, `shard2`: `uuid2:1-3`}, gtidSet)
+	assert.Equal(t, map[string]time.Time{`shard1`: time.Unix(1500000000, 0)}, eventTimes)
+	assert.Equal(t, `uuid:1-5`, v.gtidSet[`shard1`])
+	assert.Empty(t, v.eventTimes)
+}
+
+func TestDDLHistory(t *testing.T) {
+	event := isql.DdlEvent{SourceName: `shard1`, Gtid: `uuid:8`, Query: `DROP TABLE t`, Timestamp: 1500000000}
+
+	record := newPendingDDL(event, []string{`DROP TABLE t`}, nil)
+	assert.Equal(t, time.Unix(1500000000, 0), record.EventTime)
+	assert.Empty(t, record.Error)
+
+	assert.Equal(t, fmt.Sprintf(`INSERT INTO public."__repligator_ddl"(name,gtid,query,vsql,outcome,error,event_time,"timestamp") VALUES ('shard1','uuid:8','DROP TABLE t','DROP TABLE t','applied','',%s,NOW())`,
+		`'`+formatTime(time.Unix(1500000000, 0))+`'`), getDDLAuditSQL(record, ddlOutcomeApplied))
+
+	record = newPendingDDL(event, nil, fmt.Errorf(`DDL case not found`))
+	assert.Equal(t, `DDL case not found`, record.Error)
+	assert.True(t, strings.Contains(getDDLAuditSQL(record, ddlOutcomeFailed), `'','failed','DDL case not found'`))
+}
+
+func TestDDLAuditTruncate(t *testing.T) {
+	record := PendingDDL{Source: `shard1`, Gtid: `uuid:8`}
+
+	//long query fits column, multibyte character not cut
+	record.Query = strings.Repeat(`a`, ddlAuditTextLimit-1) + `я`
+	assert.Equal(t, ddlAuditTextLimit-1, len(truncateString(record.Query, ddlAuditTextLimit)))
+	assert.True(t, strings.Contains(getDDLAuditSQL(record, ddlOutcomeFailed), `'`+strings.Repeat(`a`, ddlAuditTextLimit-1)+`',`))
+}
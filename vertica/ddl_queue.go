@@ -0,0 +1,223 @@
+package vertica
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/b13f/repligator/isql"
+)
+
+//actions on not applied DDL
+const (
+	DDLSkip  = "skip"
+	DDLRetry = "retry"
+	DDLApply = "apply"
+	//statements one by one, then audit record and position in one transaction
+	DDLReplace = "replace"
+)
+
+//PendingDDL is DDL not applied to destination, replication waits action on it
+type PendingDDL struct {
+	Source    string    `json:"source"`
+	Gtid      string    `json:"gtid"`
+	Query     string    `json:"query"`
+	Vsql      []string  `json:"vsql"`
+	Error     string    `json:"error"`
+	EventTime time.Time `json:"event_time"` //binlog time of DDL
+	Since     time.Time `json:"since"`
+}
+
+type ddlAction struct {
+	gtid   string
+	action string
+	vsql   []string
+	result chan ddlResult
+}
+
+//error of action and count of replacement statements applied by it
+type ddlResult struct {
+	applied int
+	err     error
+}
+
+//DDL waiting action and channel of actions to apply loop
+type ddlQueue struct {
+	sync.Mutex
+	pending []PendingDDL
+	actions chan ddlAction
+}
+
+//return transaction gtid of DDL, gtid set for events without it
+func getDDLGtid(event isql.DdlEvent) string {
+	if len(event.GetGtid()) > 0 {
+		return event.GetGtid()
+	}
+
+	return event.GetGtidSet()
+}
+
+func (q *ddlQueue) set(pending []PendingDDL) {
+	q.Lock()
+	q.pending = pending
+	q.Unlock()
+}
+
+//GetPendingDDL return DDL waiting action
+func (vc *Cache) GetPendingDDL() []PendingDDL {
+	vc.ddl.Lock()
+	defer vc.ddl.Unlock()
+
+	return append([]PendingDDL{}, vc.ddl.pending...)
+}
+
+//ResolveDDL skip, retry, apply or replace by vsql pending DDL with gtid, return count of applied replacement statements and error of action,
+//Vertica commits DDL implicitly, so replacement statements applied before error are not rolled back
+func (vc *Cache) ResolveDDL(gtid, action string, vsql []string) (applied int, err error) {
+	switch action {
+	case DDLSkip, DDLRetry:
+	case DDLApply, DDLReplace:
+		if len(vsql) == 0 {
+			return 0, fmt.Errorf(`vsql required for %s`, action)
+		}
+	default:
+		return 0, fmt.Errorf(`unknown DDL action %s`, action)
+	}
+
+	result := make(chan ddlResult, 1)
+
+	select {
+	case vc.ddl.actions <- ddlAction{gtid: gtid, action: action, vsql: vsql, result: result}:
+	case <-time.After(time.Second * 5):
+		return 0, fmt.Errorf(`DDL %s not pending`, gtid)
+	}
+
+	r := <-result
+
+	return r.applied, r.err
+}
+
+//return record of DDL event
+func newPendingDDL(event isql.DdlEvent, vsql []string, err error) PendingDDL {
+	pending := PendingDDL{
+		Source: event.GetSourceName(),
+		Gtid:   getDDLGtid(event),
+		Query:  event.GetQuery(),
+		Vsql:   vsql,
+		Since:  time.Now(),
+	}
+
+	if event.GetTimestamp() > 0 {
+		pending.EventTime = time.Unix(int64(event.GetTimestamp()), 0)
+	}
+
+	if err != nil {
+		pending.Error = err.Error()
+	}
+
+	return pending
+}
+
+//wait action on not applied DDL
+//return outcome, resolved DDL and true if position written with it
+func (vc *Cache) waitDDL(event isql.DdlEvent, pending PendingDDL) (outcome string, resolved PendingDDL, positioned bool) {
+	vc.ddl.set([]PendingDDL{pending})
+	vc.setLoopTime(true)
+
+	defer func() {
+		vc.ddl.set(nil)
+		vc.setLoopTime(false)
+	}()
+
+	var vsql []string
+	var err error
+
+	for {
+		a := <-vc.ddl.actions
+
+		if a.gtid != pending.Gtid {
+			a.result <- ddlResult{err: fmt.Errorf(`DDL %s not pending`, a.gtid)}
+			continue
+		}
+
+		switch a.action {
+		case DDLSkip:
+			log.Infof(`Transaction: %s skipped`, pending.Query)
+			ddlSkipped.Inc()
+			a.result <- ddlResult{}
+			return ddlOutcomeSkipped, pending, false
+		case DDLRetry:
+			if vsql, err = vc.getDDLFromEvent(event); err == nil && len(vsql) > 0 {
+				_, err = vc.Exec(vsql)
+			}
+		case DDLApply:
+			vsql = a.vsql
+			_, err = vc.Exec(vsql)
+		case DDLReplace:
+			resolved = pending
+			resolved.Vsql = a.vsql
+
+			applied, rerr := vc.replaceDDL(event, resolved)
+			if rerr == nil {
+				log.Infof(`DDL %s replaced: %v`, pending.Gtid, a.vsql)
+				a.result <- ddlResult{applied: applied}
+				return ddlOutcomeReplaced, resolved, true
+			}
+
+			//applied statements are committed, rest of them stay pending
+			pending.Vsql = a.vsql[applied:]
+			pending.Error = fmt.Sprintf(`%d of %d replacement statements applied: %s`, applied, len(a.vsql), rerr.Error())
+			vc.ddl.set([]PendingDDL{pending})
+
+			if applied > 0 {
+				record := pending
+				record.Vsql = a.vsql[:applied]
+				vc.recordFailedDDL(record)
+			}
+
+			a.result <- ddlResult{applied: applied, err: errors.New(pending.Error)}
+			continue
+		}
+
+		if err == nil {
+			log.Infof(`DDL %s applied by %s: %v`, pending.Gtid, a.action, vsql)
+			a.result <- ddlResult{}
+			pending.Vsql, pending.Error = vsql, ``
+
+			if len(vsql) == 0 {
+				return ddlOutcomeIgnored, pending, false
+			}
+
+			return ddlOutcomeApplied, pending, false
+		}
+
+		pending.Vsql, pending.Error = vsql, err.Error()
+		vc.ddl.set([]PendingDDL{pending})
+		a.result <- ddlResult{err: err}
+	}
+}
+
+//apply action to pending DDL, return result message
+func (vc *Cache) resolveDDLMessage(gtid, action string, vsql []string) string {
+	if _, err := vc.ResolveDDL(gtid, action, vsql); err != nil {
+		return fmt.Sprintf(`DDL %s %s error: %s`, gtid, action, err.Error())
+	}
+
+	return fmt.Sprintf(`DDL %s %s done`, gtid, action)
+}
+
+//skip pending DDL with gtid, return result message
+func (vc *Cache) skipDDLMessage(gtid string) string {
+	if gtid == "" {
+		return `GTID of DDL to skip required`
+	}
+
+	if vc.isCacheExist() {
+		return `Can not skip transaction! Cache is not cleared.`
+	}
+
+	return vc.resolveDDLMessage(gtid, DDLSkip, nil)
+}
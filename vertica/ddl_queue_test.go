@@ -0,0 +1,55 @@
+package vertica
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingDDL(t *testing.T) {
+	v := New(Config{})
+	event := isql.DdlEvent{SourceName: `shard1`, Gtid: `uuid:7`, GtidSet: `uuid:1-7`, Query: `ALTER TABLE t ENGINE=InnoDB`}
+
+	done := make(chan string)
+	go func() {
+		outcome, _, _ := v.waitDDL(event, newPendingDDL(event, []string{`ALTER TABLE t`}, fmt.Errorf(`syntax error`)))
+		done <- outcome
+	}()
+
+	for len(v.GetPendingDDL()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	pending := v.GetPendingDDL()[0]
+	assert.Equal(t, `shard1`, pending.Source)
+	assert.Equal(t, `uuid:7`, pending.Gtid)
+	assert.Equal(t, []string{`ALTER TABLE t`}, pending.Vsql)
+	assert.Equal(t, `syntax error`, pending.Error)
+
+	_, err := v.ResolveDDL(`uuid:7`, `drop`, nil)
+	assert.Error(t, err)
+	_, err = v.ResolveDDL(`uuid:7`, DDLReplace, nil)
+	assert.EqualError(t, err, `vsql required for replace`)
+	_, err = v.ResolveDDL(`uuid:8`, DDLSkip, nil)
+	assert.EqualError(t, err, `DDL uuid:8 not pending`)
+
+	//skip requires gtid of pending DDL
+	bot := v.GetBotInterfaces()
+	assert.Equal(t, `GTID of DDL to skip required`, bot[`skip`](`skip`))
+	w := httptest.NewRecorder()
+	v.GetHTTPInterfaces()[`/skip`](w, httptest.NewRequest(`GET`, `/skip`, nil))
+	assert.Equal(t, `GTID of DDL to skip required`, w.Body.String())
+	assert.Len(t, v.GetPendingDDL(), 1)
+	assert.Equal(t, `DDL uuid:7 skip done`, bot[`skip`](`skip uuid:7`))
+
+	assert.Equal(t, ddlOutcomeSkipped, <-done)
+	assert.Empty(t, v.GetPendingDDL())
+}
+
+func TestDDLGtid(t *testing.T) {
+	assert.Equal(t, `uuid:1-7`, getDDLGtid(isql.DdlEvent{GtidSet: `uuid:1-7`}))
+}
@@ -184,3 +184,104 @@ func (s *DDLTestSuite) TestAlterTable() {
 		`COMMENT ON TABLE "altertest"."test" IS 'enum(3[''1'',''2'',''3'']);enum(2["f","s","l"])'`,
 	}, t)
 }
+
+func (s *DDLTestSuite) TestCreateTableWithSource() {
+	s.v.sourceColumn = `_source`
+	defer func() { s.v.sourceColumn = `` }()
+
+	t := s.v.GetTableSQL(isql.CreateTable{
+		Table: isql.Table{Schema: `testing`, Name: `test`},
+		Columns: []isql.Column{
+			{Name: `id`, Type: `bigint(20)`},
+			{Name: `value`, Type: `varchar(255)`},
+		},
+		Constraints: []isql.Constraint{
+			{Type: isql.Primary, Columns: []string{`id`}},
+			{Type: isql.Unique, Columns: []string{`value`}},
+		},
+	})
+
+	s.Equal([]string{`CREATE TABLE IF NOT EXISTS "testing"."test"
+(
+"id" NUMBER,
+"value" VARCHAR(255),
+"_source" VARCHAR(255),
+PRIMARY KEY ("id","_source") ENABLED,
+UNIQUE ("value","_source") ENABLED) ORDER BY "id","_source"`}, t)
+
+	s.Equal([]string{`DELETE FROM "testing"."test" WHERE "_source"='shard1'`},
+		s.v.getSourceTruncateSQL(isql.TruncateTable{isql.Table{Schema: `testing`, Name: `test`}}, `shard1`))
+}
+
+func (s *DDLTestSuite) TestCreateTableSoftDelete() {
+	s.v.tablesConf = []TableConfig{{Name: `testing.*`, SoftDelete: true}}
+	defer func() { s.v.tablesConf = nil }()
+
+	t := s.v.GetTableSQL(isql.CreateTable{
+		Table: isql.Table{Schema: `testing`, Name: `test`},
+		Columns: []isql.Column{
+			{Name: `id`, Type: `bigint(20)`},
+		},
+		Constraints: []isql.Constraint{
+			{Type: isql.Primary, Columns: []string{`id`}},
+		},
+	})
+
+	s.Equal([]string{`CREATE TABLE IF NOT EXISTS "testing"."test"
+(
+"id" NUMBER,
+"_deleted" BOOLEAN DEFAULT false,
+"_deleted_at" TIMESTAMPTZ,
+PRIMARY KEY ("id") DISABLED) ORDER BY "id"`}, t)
+}
+
+func (s *DDLTestSuite) TestCreateTableMetaColumns() {
+	s.v.metaColumns = getMetaColumns([]string{gtidColumn, binlogTsColumn, opColumn, `_unknown`})
+	defer func() { s.v.metaColumns = nil }()
+
+	t := s.v.GetTableSQL(isql.CreateTable{
+		Table: isql.Table{Schema: `testing`, Name: `test`},
+		Columns: []isql.Column{
+			{Name: `id`, Type: `bigint(20)`},
+		},
+		Constraints: []isql.Constraint{
+			{Type: isql.Primary, Columns: []string{`id`}},
+		},
+	})
+
+	s.Equal([]string{`CREATE TABLE IF NOT EXISTS "testing"."test"
+(
+"id" NUMBER,
+"_gtid" VARCHAR(1024),
+"_binlog_ts" TIMESTAMPTZ,
+"_op" VARCHAR(10),
+PRIMARY KEY ("id") ENABLED) ORDER BY "id"`}, t)
+}
+
+func (s *DDLTestSuite) TestAlterTableHistory() {
+	_, _ = s.v.Exec([]string{
+		`CREATE SCHEMA IF NOT EXISTS altertest`,
+		`CREATE TABLE IF NOT EXISTS altertest.versions (id NUMBER,val VARCHAR(60))`,
+	})
+
+	s.v.tablesConf = []TableConfig{{Name: `altertest.versions`, History: true}}
+	defer func() { s.v.tablesConf = nil }()
+
+	t, err := s.v.getAlterSQL(isql.AlterTable{
+		Table:       isql.Table{Schema: `altertest`, Name: `versions`},
+		AddColumns:  []isql.Column{{Name: `note`, Type: `varchar(20)`}},
+		DropColumns: []isql.Column{{Name: `val`}},
+	})
+
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	//dropped column stays in history
+	s.Equal([]string{
+		getHistorySQL(`altertest`, `versions`),
+		`ALTER TABLE "altertest"."versions_history" ADD COLUMN "note" VARCHAR(20)`,
+		`ALTER TABLE "altertest"."versions" DROP COLUMN "val" CASCADE`,
+		`ALTER TABLE "altertest"."versions" ADD COLUMN "note" VARCHAR(20)`,
+	}, t)
+}
@@ -0,0 +1,9 @@
+//go:build !nonative
+// +build !nonative
+
+package vertica
+
+import (
+	//include native protocol driver, build with nonative tag to use only ODBC driver
+	_ "github.com/vertica/vertica-sql-go"
+)
@@ -0,0 +1,9 @@
+//go:build !noodbc
+// +build !noodbc
+
+package vertica
+
+import (
+	//include ODBC driver, build with noodbc tag to use only native driver
+	_ "github.com/alexbrainman/odbc"
+)
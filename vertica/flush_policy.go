@@ -0,0 +1,311 @@
+package vertica
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var tablePosCreateSQL = `CREATE TABLE IF NOT EXISTS public."__repligator_table_pos" (name VARCHAR(1024),table_name VARCHAR(1024),gtid VARCHAR(1024),"timestamp" TIMESTAMPTZ, PRIMARY KEY (name,table_name)) ORDER BY name,table_name`
+
+var tablePosSQL = `SELECT name,table_name,gtid FROM public."__repligator_table_pos"`
+
+var tablePosUpdateSQL = `UPDATE public."__repligator_table_pos" SET gtid='%s',"timestamp"=NOW() WHERE name='%s' AND table_name='%s'`
+
+var tablePosInsertSQL = `INSERT INTO public."__repligator_table_pos"(name,table_name,gtid,"timestamp") VALUES ('%s','%s','%s',NOW())`
+
+var tablePosClearSQL = `DELETE FROM public."__repligator_table_pos" WHERE name='%s'`
+
+//load positions of tables flushed ahead of source position
+func (vc *Cache) loadTablePositions() (err error) {
+	rows, err := vc.db.Query(tablePosSQL)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	var name, table, gtid string
+
+	for rows.Next() {
+		if err = rows.Scan(&name, &table, &gtid); err != nil {
+			return
+		}
+
+		if vc.tablesPos[name] == nil {
+			vc.tablesPos[name] = make(map[string]string)
+		}
+
+		vc.tablesPos[name][table] = gtid
+	}
+
+	return
+}
+
+//check transaction already written to table by its own flush
+func (vc *Cache) isTableApplied(source, schema, table, gtid string) bool {
+	pos, ok := vc.tablesPos[source][schema+`.`+table]
+
+	return ok && gtidContains(pos, gtid)
+}
+
+//check gtid uuid:N is in set of uuid:start-last intervals
+func gtidContains(set, gtid string) bool {
+	i := strings.LastIndex(gtid, `:`)
+	if i < 0 {
+		return false
+	}
+
+	no, err := strconv.Atoi(gtid[i+1:])
+	if err != nil {
+		return false
+	}
+
+	for _, interval := range strings.Split(set, `,`) {
+		j := strings.LastIndex(interval, `:`)
+		if j < 0 || interval[:j] != gtid[:i] {
+			continue
+		}
+
+		bounds := strings.SplitN(interval[j+1:], `-`, 2)
+		start, err1 := strconv.Atoi(bounds[0])
+		last := start
+		var err2 error
+		if len(bounds) == 2 {
+			last, err2 = strconv.Atoi(bounds[1])
+		}
+
+		if err1 == nil && err2 == nil && no >= start && no <= last {
+			return true
+		}
+	}
+
+	return false
+}
+
+//remember source position before first cached change of table
+func (vc *Cache) markPending(schema, table string, rows int) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	t, ok := vc.tables[schema+table]
+	if !ok {
+		return
+	}
+
+	if t.pendingFrom == nil {
+		t.pendingFrom = make(map[string]string)
+		for name, set := range vc.gtidSet {
+			t.pendingFrom[name] = set
+		}
+		t.pendingTimes = make(map[string]time.Time)
+		for name, ts := range vc.eventTimes {
+			t.pendingTimes[name] = ts
+		}
+		t.pendingSince = time.Now()
+		t.pendingSeq = vc.eventSeq
+	}
+
+	t.rows += rows
+
+	vc.tables[schema+table] = t
+}
+
+func (t *tableCache) resetPending() {
+	t.pendingFrom = nil
+	t.rows = 0
+}
+
+func (t *tableCache) hasFlushPolicy() bool {
+	return t.flushCount > 0 || t.flushTime > 0
+}
+
+//check table own flush policy is reached, table without own flush time is due after global one
+func (t *tableCache) isDue(now time.Time, globalTime int) bool {
+	if t.pendingFrom == nil {
+		return false
+	}
+
+	flushTime := t.flushTime
+	if flushTime == 0 {
+		flushTime = globalTime
+	}
+
+	return (t.flushCount > 0 && t.rows >= t.flushCount) ||
+		(flushTime > 0 && now.Sub(t.pendingSince).Seconds() >= float64(flushTime))
+}
+
+//return delete pack size of table
+func (t *tableCache) getPack(vert *Cache) int {
+	if t.pack > 0 {
+		return t.pack
+	}
+
+	return vert.delPack
+}
+
+//return tables reached own flush policy
+func (vc *Cache) getDueTables() (names []string) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	now := time.Now()
+
+	for name, table := range vc.tables {
+		if table.hasFlushPolicy() && table.isDue(now, vc.flushTime) {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+//return tables flushed by global policy, tables with own policy only when due
+func (vc *Cache) getGlobalTables() (names []string) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	now := time.Now()
+
+	for name, table := range vc.tables {
+		if !table.hasFlushPolicy() || table.isDue(now, vc.flushTime) {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+//return names of all cached tables
+func (vc *Cache) getTableNames() (names []string) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	for name := range vc.tables {
+		names = append(names, name)
+	}
+
+	return
+}
+
+//check some tables have cached changes
+func (vc *Cache) hasPending() bool {
+	vc.Lock()
+	defer vc.Unlock()
+
+	for _, table := range vc.tables {
+		if table.pendingFrom != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+//return tables with cached changes not in flushed list
+func (vc *Cache) getUnflushed(names []string) (unflushed []tableCache) {
+	flushed := make(map[string]bool)
+	for _, name := range names {
+		flushed[name] = true
+	}
+
+	for name, table := range vc.tables {
+		if !flushed[name] && table.pendingFrom != nil {
+			unflushed = append(unflushed, table)
+		}
+	}
+
+	return
+}
+
+//return table with oldest change not flushed
+func getOldestUnflushed(unflushed []tableCache) tableCache {
+	oldest := unflushed[0]
+	for _, table := range unflushed[1:] {
+		if table.pendingSeq < oldest.pendingSeq {
+			oldest = table
+		}
+	}
+
+	return oldest
+}
+
+//return source position before oldest change not flushed
+func getSafePosition(gtidSet map[string]string, unflushed []tableCache) map[string]string {
+	if len(unflushed) == 0 {
+		return gtidSet
+	}
+
+	return getOldestUnflushed(unflushed).pendingFrom
+}
+
+//return event times of source position before oldest change not flushed
+func getSafeEventTimes(eventTimes map[string]time.Time, unflushed []tableCache) map[string]time.Time {
+	if len(unflushed) == 0 {
+		return eventTimes
+	}
+
+	return getOldestUnflushed(unflushed).pendingTimes
+}
+
+//write positions of tables flushed ahead of source position
+func (vc *Cache) flushTablePositions(names []string) (err error) {
+	var res sql.Result
+	var aff int64
+
+	for _, name := range names {
+		table := vc.tables[name]
+		tableName := table.schema + `.` + table.name
+
+		for sourceName, set := range vc.gtidSet {
+			if res, err = vc.forceExec(fmt.Sprintf(tablePosUpdateSQL, set, sourceName, tableName)); err != nil {
+				return
+			}
+
+			if aff, err = res.RowsAffected(); err != nil {
+				return
+			}
+
+			if aff == 0 {
+				if _, err = vc.forceExec(fmt.Sprintf(tablePosInsertSQL, sourceName, tableName, set)); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+//forget table positions when all tables reached source position
+func (vc *Cache) clearTablePositions() (err error) {
+	for source := range vc.tablesPos {
+		if _, err = vc.forceExec(fmt.Sprintf(tablePosClearSQL, source)); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//update known table positions after commit
+func (vc *Cache) setTablePositions(names []string, full bool) {
+	if full {
+		vc.tablesPos = make(map[string]map[string]string)
+		return
+	}
+
+	for _, name := range names {
+		table := vc.tables[name]
+
+		for source, set := range vc.gtidSet {
+			if vc.tablesPos[source] == nil {
+				vc.tablesPos[source] = make(map[string]string)
+			}
+
+			vc.tablesPos[source][table.schema+`.`+table.name] = set
+		}
+	}
+}
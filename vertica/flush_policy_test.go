@@ -0,0 +1,91 @@
+package vertica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//cache with fast table flushed globally and slow table flushed by its count
+func newPolicyCache() *Cache {
+	v := New(Config{Pack: 100})
+	v.tables = map[string]tableCache{
+		`testingfast`: {schema: `testing`, name: `fast`, tIns: make(map[string]string)},
+		`testingslow`: {schema: `testing`, name: `slow`, tIns: make(map[string]string), flushCount: 2, pack: 10},
+	}
+
+	return v
+}
+
+func TestFlushPolicy(t *testing.T) {
+	v := newPolicyCache()
+
+	v.markPending(`testing`, `slow`, 1)
+	v.markPending(`testing`, `fast`, 1)
+
+	assert.Empty(t, v.getDueTables())
+	assert.Equal(t, []string{`testingfast`}, v.getGlobalTables())
+
+	v.markPending(`testing`, `slow`, 1)
+	assert.Equal(t, []string{`testingslow`}, v.getDueTables())
+
+	slow := v.tables[`testingslow`]
+	fast := v.tables[`testingfast`]
+	assert.Equal(t, 10, slow.getPack(v))
+	assert.Equal(t, 100, fast.getPack(v))
+}
+
+func TestFlushCountDueByGlobalTime(t *testing.T) {
+	v := New(Config{FlushTime: 60})
+	v.tables = map[string]tableCache{
+		`testingrare`: {schema: `testing`, name: `rare`, tIns: make(map[string]string), flushCount: 1000},
+	}
+
+	v.markPending(`testing`, `rare`, 1)
+	assert.Empty(t, v.getDueTables())
+	assert.Empty(t, v.getGlobalTables())
+
+	//count not reached, table waits global flush time only
+	rare := v.tables[`testingrare`]
+	rare.pendingSince = time.Now().Add(-time.Minute)
+	v.tables[`testingrare`] = rare
+
+	assert.Equal(t, []string{`testingrare`}, v.getDueTables())
+	assert.Equal(t, []string{`testingrare`}, v.getGlobalTables())
+}
+
+func TestSafePosition(t *testing.T) {
+	v := newPolicyCache()
+
+	v.gtidSet = map[string]string{`shard1`: `uuid:1-5`}
+	v.eventSeq = 1
+	v.markPending(`testing`, `slow`, 1)
+	v.gtidSet = map[string]string{`shard1`: `uuid:1-6`}
+	v.eventSeq = 2
+	v.markPending(`testing`, `fast`, 1)
+
+	//position stays before first change of table left in cache
+	unflushed := v.getUnflushed([]string{`testingfast`})
+	assert.Equal(t, map[string]string{`shard1`: `uuid:1-5`}, getSafePosition(v.gtidSet, unflushed))
+	assert.Equal(t, v.gtidSet, getSafePosition(v.gtidSet, v.getUnflushed(v.getTableNames())))
+}
+
+func TestTableApplied(t *testing.T) {
+	v := newPolicyCache()
+	v.gtidSet = map[string]string{`shard1`: `uuid:1-6`}
+
+	v.setTablePositions([]string{`testingfast`}, false)
+	assert.True(t, v.isTableApplied(`shard1`, `testing`, `fast`, `uuid:6`))
+	assert.False(t, v.isTableApplied(`shard1`, `testing`, `fast`, `uuid:7`))
+	assert.False(t, v.isTableApplied(`shard1`, `testing`, `slow`, `uuid:6`))
+
+	v.setTablePositions(nil, true)
+	assert.False(t, v.isTableApplied(`shard1`, `testing`, `fast`, `uuid:6`))
+}
+
+func TestGtidContains(t *testing.T) {
+	assert.True(t, gtidContains(`other:1-3,uuid:4-9`, `uuid:4`))
+	assert.False(t, gtidContains(`uuid:4-9`, `uuid:3`))
+	assert.False(t, gtidContains(`uuid:4-9`, `other:5`))
+}
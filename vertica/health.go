@@ -0,0 +1,64 @@
+package vertica
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//mark apply loop iteration
+func (vc *Cache) setLoopTime(waitDDL bool) {
+	vc.status.Lock()
+	vc.status.loopAt = time.Now()
+	vc.status.waitDDL = waitDDL
+	vc.status.Unlock()
+}
+
+//GetLoopState return time of last apply loop iteration, start of running flush (zero if none) and true if loop waits action on pending DDL
+func (vc *Cache) GetLoopState() (loopAt time.Time, flushStart time.Time, waitDDL bool) {
+	vc.status.Lock()
+	defer vc.status.Unlock()
+
+	if vc.status.flushing != nil {
+		flushStart = vc.status.flushStart
+	}
+
+	return vc.status.loopAt, flushStart, vc.status.waitDDL
+}
+
+//Ping check destination is reachable, running flush holds pool connections,
+//so flush in progress is reachable unless last flush failed
+func (vc *Cache) Ping(ctx context.Context) error {
+	if flushing, err := vc.getFlushHealth(); flushing {
+		return err
+	}
+
+	if vc.db == nil {
+		return errors.New(`not connected`)
+	}
+
+	err := vc.db.PingContext(ctx)
+
+	//flush took connection while ping waited for it
+	if flushing, flushErr := vc.getFlushHealth(); err != nil && flushing {
+		return flushErr
+	}
+
+	return err
+}
+
+//return true if flush is running and error of last flush
+func (vc *Cache) getFlushHealth() (bool, error) {
+	vc.status.Lock()
+	defer vc.status.Unlock()
+
+	if vc.status.flushing == nil {
+		return false, nil
+	}
+
+	if vc.status.lastFlush != nil && vc.status.lastFlush.Error != "" {
+		return true, errors.New(`last flush failed: ` + vc.status.lastFlush.Error)
+	}
+
+	return true, nil
+}
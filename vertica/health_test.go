@@ -0,0 +1,46 @@
+package vertica
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopState(t *testing.T) {
+	v := New(Config{})
+
+	v.setLoopTime(true)
+	_, flushStart, waitDDL := v.GetLoopState()
+	assert.True(t, flushStart.IsZero())
+	assert.True(t, waitDDL)
+
+	//long flush does not stop loop time, its start is reported
+	v.setLoopTime(false)
+	start := time.Now().Add(-time.Hour)
+	v.startFlushStatus(start)
+	_, flushStart, waitDDL = v.GetLoopState()
+	assert.Equal(t, start, flushStart)
+	assert.False(t, waitDDL)
+
+	v.endFlushStatus(start, 0, nil)
+	_, flushStart, _ = v.GetLoopState()
+	assert.True(t, flushStart.IsZero())
+}
+
+func TestPingFlushState(t *testing.T) {
+	v := New(Config{})
+
+	//running flush holds connections, ping does not wait for them
+	start := time.Now()
+	v.startFlushStatus(start)
+	assert.NoError(t, v.Ping(context.Background()))
+
+	v.endFlushStatus(start, 0, nil)
+	assert.EqualError(t, v.Ping(context.Background()), `not connected`)
+
+	v.status.lastFlush.Error = `connection lost`
+	v.status.flushing = &Status{}
+	assert.EqualError(t, v.Ping(context.Background()), `last flush failed: connection lost`)
+}
@@ -0,0 +1,100 @@
+package vertica
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/b13f/repligator/isql"
+)
+
+var heartbeatLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "repligator_heartbeat_latency_seconds",
+	Help: "Seconds from heartbeat row write on source to its commit in destination.",
+}, []string{"source"})
+
+func init() {
+	prometheus.MustRegister(heartbeatLatency)
+}
+
+//SetHeartbeatSchema set schema of heartbeat table written by source
+func (vc *Cache) SetHeartbeatSchema(source, schema string) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	vc.hbSchemas[source] = schema
+}
+
+//remember latest heartbeat written by source in its heartbeat schema, ts in milliseconds
+func (t *tableCache) addHeartbeat(source, schema string, rows [][]interface{}) {
+	if t.name != isql.HeartbeatTable || schema == "" || t.schema != schema {
+		return
+	}
+
+	for _, row := range rows {
+		if len(row) < 2 || !isHeartbeatSource(row[0], source) {
+			continue
+		}
+
+		var ts int64
+
+		switch val := row[1].(type) {
+		case int64:
+			ts = val
+		case uint64:
+			ts = int64(val)
+		case int:
+			ts = int64(val)
+		default:
+			continue
+		}
+
+		if t.heartbeats == nil {
+			t.heartbeats = make(map[string]int64)
+		}
+
+		if ts > t.heartbeats[source] {
+			t.heartbeats[source] = ts
+		}
+	}
+}
+
+//check heartbeat row written by source
+func isHeartbeatSource(value interface{}, source string) bool {
+	switch val := value.(type) {
+	case string:
+		return val == source
+	case []byte:
+		return string(val) == source
+	}
+
+	return false
+}
+
+//save latency of heartbeats committed in destination
+func (vc *Cache) setHeartbeats(heartbeats map[string]int64, now time.Time) {
+	for source, ts := range heartbeats {
+		latency := now.Sub(time.Unix(0, ts*int64(time.Millisecond))).Seconds()
+
+		vc.heartbeatLag[source] = latency
+		heartbeatLatency.WithLabelValues(source).Set(latency)
+	}
+}
+
+//return heartbeat latency of sources as text, cache locked
+func (vc *Cache) getHeartbeatInfo() (out string) {
+	var names []string
+	for name := range vc.heartbeatLag {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		out += fmt.Sprintf("heartbeat: [%s] %.1fs\n", name, vc.heartbeatLag[name])
+	}
+
+	return
+}
@@ -0,0 +1,33 @@
+package vertica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	v := New(Config{})
+	hb := tableCache{schema: `repligator`, name: isql.HeartbeatTable}
+
+	hb.addHeartbeat(`shard1`, `repligator`, [][]interface{}{{`shard1`, int64(1000000)}, {`shard1`, int64(999000)}, {`shard2`, int64(2000000)}})
+	assert.Equal(t, map[string]int64{`shard1`: 1000000}, hb.heartbeats)
+
+	v.setHeartbeats(hb.heartbeats, time.Unix(1002, 500000000))
+	assert.Equal(t, map[string]float64{`shard1`: 2.5}, v.heartbeatLag)
+	assert.Equal(t, "heartbeat: [shard1] 2.5s\n", v.getHeartbeatInfo())
+}
+
+func TestHeartbeatOtherTable(t *testing.T) {
+	other := tableCache{schema: `repligator`, name: `other`}
+	other.addHeartbeat(`shard1`, `repligator`, [][]interface{}{{`shard1`, int64(1000000)}})
+	assert.Nil(t, other.heartbeats)
+
+	//same table name in application schema is not a heartbeat
+	app := tableCache{schema: `app`, name: isql.HeartbeatTable}
+	app.addHeartbeat(`shard1`, `repligator`, [][]interface{}{{`shard1`, int64(1000000)}})
+	app.addHeartbeat(`shard1`, ``, [][]interface{}{{`shard1`, int64(1000000)}})
+	assert.Nil(t, app.heartbeats)
+}
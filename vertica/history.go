@@ -0,0 +1,193 @@
+package vertica
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/b13f/repligator/isql"
+)
+
+//history table columns
+const (
+	historySuffix       = "_history"
+	validFromColumn     = "_valid_from"
+	validToColumn       = "_valid_to"
+	historyOpColumn     = "_history_op"
+	historyGtidColumn   = "_history_gtid"
+	historySnapshotOp   = "snapshot"
+	historyOpColumnType = "VARCHAR(10)"
+	historyGtidType     = "VARCHAR(1024)"
+)
+
+//existed rows become open versions of new history table
+var historyCreateTmpl = `CREATE TABLE IF NOT EXISTS "%s"."%s` + historySuffix + `" AS SELECT *,
+	NULL::TIMESTAMPTZ AS "` + validFromColumn + `",
+	NULL::TIMESTAMPTZ AS "` + validToColumn + `",
+	'` + historySnapshotOp + `'::` + historyOpColumnType + ` AS "` + historyOpColumn + `",
+	NULL::` + historyGtidType + ` AS "` + historyGtidColumn + `"
+	FROM "%s"."%s"`
+
+var historyCloseTmpl = `UPDATE "%s"."%s` + historySuffix + `" SET "` + validToColumn + `"='%s' WHERE %s AND "` + validToColumn + `" IS NULL`
+
+//versions of rows changed in batch
+type historyCache struct {
+	rows   []historyRow
+	open   map[string]int      //key to index of open version in rows
+	seen   map[string]bool     //keys already closed in vertica
+	closes map[string][]string //change time to keys of versions to close in vertica
+	memory int                 //approximate size of versions and keys
+}
+
+type historyRow struct {
+	values []interface{}
+	from   interface{}
+	to     interface{}
+	op     string
+	gtid   string
+}
+
+func newHistoryCache() *historyCache {
+	return &historyCache{open: make(map[string]int), seen: make(map[string]bool), closes: make(map[string][]string)}
+}
+
+func (h *historyCache) len() int {
+	if h == nil {
+		return 0
+	}
+
+	return len(h.rows)
+}
+
+//close current version of row
+func (h *historyCache) close(key string, change rowsChange) {
+	if i, ok := h.open[key]; ok {
+		h.rows[i].to = change.ts
+		delete(h.open, key)
+		return
+	}
+
+	//version written before batch
+	if !h.seen[key] {
+		h.seen[key] = true
+		h.closes[change.ts] = append(h.closes[change.ts], key)
+		h.memory += len(key)
+	}
+}
+
+func (h *historyCache) hasCloses() bool {
+	return h != nil && len(h.closes) > 0
+}
+
+//add new version of row, version before batch closed by update
+func (h *historyCache) add(key string, row []interface{}, change rowsChange) {
+	if i, ok := h.open[key]; ok {
+		h.rows[i].to = change.ts
+	}
+
+	h.open[key] = len(h.rows)
+	h.rows = append(h.rows, historyRow{values: row, from: change.ts, op: change.op, gtid: change.gtid})
+	h.memory += len(key) + rowMemory(row) + len(change.ts) + len(change.gtid)
+}
+
+//close current version and add deleted one
+func (h *historyCache) delete(key string, row []interface{}, change rowsChange) {
+	h.close(key, change)
+
+	h.rows = append(h.rows, historyRow{values: row, from: change.ts, to: change.ts, op: change.op, gtid: change.gtid})
+	h.memory += rowMemory(row) + 2*len(change.ts) + len(change.gtid)
+}
+
+//return history table create statement
+func getHistorySQL(schema, table string) string {
+	return fmt.Sprintf(historyCreateTmpl, schema, table, schema, table)
+}
+
+//create history table if not exist
+func (vc *Cache) createHistory(schema, table string) (err error) {
+	_, err = vc.db.Exec(getHistorySQL(schema, table))
+
+	return
+}
+
+//check table is history of replicated table
+func (vc *Cache) isHistoryTable(schema, table string) bool {
+	return strings.HasSuffix(table, historySuffix) && vc.getTableConfig(schema, strings.TrimSuffix(table, historySuffix)).History
+}
+
+//return key of row versions
+func (t *tableCache) historyKey(row []interface{}) string {
+	if len(t.leadConstrColNames) == 0 {
+		return t.rowCondition(row)
+	}
+
+	return t.generateKey(row)
+}
+
+//record row change in history
+func (t *tableCache) addHistory(row []interface{}, change rowsChange) {
+	switch change.op {
+	case isql.Delete:
+		t.history.delete(t.historyKey(row), row, change)
+	default:
+		t.history.add(t.historyKey(row), row, change)
+	}
+}
+
+//return statements closing versions written before batch
+func (t *tableCache) getHistoryCloseSQL(pack int) (vsqls []string) {
+	for ts, keys := range t.history.closes {
+		if len(t.leadConstrColNames) == 0 {
+			for _, cond := range keys {
+				vsqls = append(vsqls, fmt.Sprintf(historyCloseTmpl, t.schema, t.name, ts, cond))
+			}
+			continue
+		}
+
+		for start := 0; start < len(keys); start += pack {
+			end := start + pack
+			if end > len(keys) {
+				end = len(keys)
+			}
+
+			cond := t.keyColumnsSQL() + ` IN (` + strings.Join(keys[start:end], ",") + `)`
+
+			vsqls = append(vsqls, fmt.Sprintf(historyCloseTmpl, t.schema, t.name, ts, cond))
+		}
+	}
+
+	return
+}
+
+//return csv lines of history rows
+func (t *tableCache) getHistoryLines() (lines []string) {
+	for _, r := range t.history.rows {
+		row := append(append([]interface{}{}, r.values...), r.from, r.to, r.op, r.gtid)
+		lines = append(lines, generateRowCopy(row))
+	}
+
+	return
+}
+
+func (t *tableCache) historyColumns() []string {
+	return append(append([]string{}, t.columnNames...), validFromColumn, validToColumn, historyOpColumn, historyGtidColumn)
+}
+
+func (t *tableCache) tableHistoryExec(vert *Cache) (err error) {
+	if t.history == nil || (len(t.history.rows) == 0 && len(t.history.closes) == 0) {
+		return
+	}
+
+	if _, err = vert.Exec(t.getHistoryCloseSQL(t.getPack(vert))); err != nil {
+		return
+	}
+
+	if len(t.history.rows) > 0 {
+		if err = vert.copyLines(t.schema, t.name+historySuffix, t.historyColumns(), t.getHistoryLines()); err != nil {
+			return
+		}
+	}
+
+	t.history = newHistoryCache()
+
+	return
+}
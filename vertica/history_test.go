@@ -0,0 +1,31 @@
+package vertica
+
+import (
+	"testing"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryCache(t *testing.T) {
+	table := newKeyTable(`hist`, `id`, `val`)
+	table.history = newHistoryCache()
+
+	ins := rowsChange{gtid: `uuid:1`, op: isql.Insert, ts: `2017-01-01 00:00:00`}
+	upd := rowsChange{gtid: `uuid:2`, op: isql.Update, ts: `2017-01-01 00:00:01`}
+	del := rowsChange{gtid: `uuid:3`, op: isql.Delete, ts: `2017-01-01 00:00:02`}
+
+	assert.NoError(t, table.addIns(nil, ins, [][]interface{}{{1, `a`}}))
+	table.addDel(nil, upd, [][]interface{}{{1, `a`}, {2, `b`}})
+	assert.NoError(t, table.addIns(nil, upd, [][]interface{}{{1, `c`}, {2, `d`}}))
+	table.addDel(nil, del, [][]interface{}{{2, `d`}})
+
+	assert.Equal(t, []string{
+		`"1","a","2017-01-01 00:00:00","2017-01-01 00:00:01","insert","uuid:1"`,
+		`"1","c","2017-01-01 00:00:01",NULL,"update","uuid:2"`,
+		`"2","d","2017-01-01 00:00:01","2017-01-01 00:00:02","update","uuid:2"`,
+		`"2","d","2017-01-01 00:00:02","2017-01-01 00:00:02","delete","uuid:3"`,
+	}, table.getHistoryLines())
+	assert.Equal(t, []string{`UPDATE "testing"."hist_history" SET "_valid_to"='2017-01-01 00:00:01' WHERE "id" IN (2) AND "_valid_to" IS NULL`}, table.getHistoryCloseSQL(10))
+	assert.Equal(t, []string{`id`, `val`, validFromColumn, validToColumn, historyOpColumn, historyGtidColumn}, table.historyColumns())
+}
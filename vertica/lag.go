@@ -0,0 +1,147 @@
+package vertica
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var posEventTimeExistSQL = `SELECT COUNT(*) FROM v_catalog.columns WHERE table_schema='public' AND table_name='__repligator_pos' AND column_name='event_time'`
+
+var posEventTimeAddSQL = `ALTER TABLE public."__repligator_pos" ADD COLUMN "event_time" TIMESTAMPTZ`
+
+var posEventTimesSQL = `SELECT name,event_time FROM public."__repligator_pos" WHERE event_time IS NOT NULL`
+
+var destinationLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "repligator_destination_lag_seconds",
+	Help: "Seconds since binlog time of oldest transaction not committed.",
+}, []string{"source"})
+
+func init() {
+	prometheus.MustRegister(destinationLag)
+}
+
+//add event time to position table created by old versions and load committed times
+func (vc *Cache) migratePosition() (err error) {
+	var exist int
+
+	if err = vc.db.QueryRow(posEventTimeExistSQL).Scan(&exist); err != nil {
+		return
+	}
+
+	if exist == 0 {
+		if _, err = vc.db.Exec(posEventTimeAddSQL); err != nil {
+			return
+		}
+	}
+
+	rows, err := vc.db.Query(posEventTimesSQL)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	var name string
+	var eventTime time.Time
+
+	for rows.Next() {
+		if err = rows.Scan(&name, &eventTime); err != nil {
+			return
+		}
+
+		vc.committed[name] = eventTime
+	}
+
+	return
+}
+
+//remember binlog time of transaction applied to cache
+func (vc *Cache) setEventTime(source string, timestamp uint32) {
+	if timestamp > 0 {
+		vc.eventTimes[source] = time.Unix(int64(timestamp), 0)
+
+		if _, ok := vc.uncommitted[source]; !ok {
+			vc.uncommitted[source] = vc.eventTimes[source]
+		}
+	}
+}
+
+//remember binlog times of transactions written with position, position behind cache keeps oldest uncommitted time
+func (vc *Cache) setCommitted(eventTimes map[string]time.Time) {
+	for name, ts := range eventTimes {
+		vc.committed[name] = ts
+
+		if !vc.eventTimes[name].After(ts) {
+			delete(vc.uncommitted, name)
+		}
+	}
+}
+
+//return value of event time for position statements
+func eventTimeValue(eventTimes map[string]time.Time, source string) string {
+	ts, ok := eventTimes[source]
+	if !ok {
+		return `NULL`
+	}
+
+	return `'` + formatTime(ts) + `'`
+}
+
+//return seconds since binlog time of oldest uncommitted transaction of sources, zero if all applied transactions committed
+func (vc *Cache) getLag(now time.Time) map[string]float64 {
+	lag := make(map[string]float64)
+
+	for name := range vc.committed {
+		lag[name] = 0
+	}
+
+	for name, since := range vc.uncommitted {
+		lag[name] = now.Sub(since).Seconds()
+	}
+
+	return lag
+}
+
+//update lag metrics, alert when lag over threshold
+func (vc *Cache) checkLag() {
+	vc.Lock()
+	defer vc.Unlock()
+
+	for name, lag := range vc.getLag(time.Now()) {
+		destinationLag.WithLabelValues(name).Set(lag)
+
+		if vc.lagAlert == 0 {
+			continue
+		}
+
+		if lag > float64(vc.lagAlert) && !vc.lagAlerted[name] {
+			log.Warnf(`Lag of %s is %.0f seconds, over %d`, name, lag, vc.lagAlert)
+			vc.lagAlerted[name] = true
+		} else if lag <= float64(vc.lagAlert) && vc.lagAlerted[name] {
+			log.Infof(`Lag of %s is %.0f seconds, back under %d`, name, lag, vc.lagAlert)
+			vc.lagAlerted[name] = false
+		}
+	}
+}
+
+//return lag of sources as text, cache locked
+func (vc *Cache) getLagInfo() (out string) {
+	lag := vc.getLag(time.Now())
+
+	var names []string
+	for name := range lag {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		out += fmt.Sprintf("lag: [%s] %.0fs committed event %s\n", name, lag[name], formatTime(vc.committed[name]))
+	}
+
+	return
+}
@@ -0,0 +1,45 @@
+package vertica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLag(t *testing.T) {
+	v := New(Config{LagAlert: 10})
+	now := time.Unix(1000, 0)
+
+	v.committed[`shard1`] = time.Unix(100, 0)
+	v.committed[`shard2`] = time.Unix(900, 0)
+	v.eventTimes[`shard2`] = time.Unix(900, 0)
+
+	//idle source lags from its first uncommitted transaction, not from last committed one
+	v.setEventTime(`shard1`, 950)
+	v.setEventTime(`shard1`, 980)
+
+	assert.Equal(t, map[string]float64{`shard1`: 50, `shard2`: 0}, v.getLag(now))
+
+	unflushed := []tableCache{{pendingSeq: 2, pendingTimes: map[string]time.Time{`shard1`: time.Unix(920, 0)}}}
+	assert.Equal(t, map[string]time.Time{`shard1`: time.Unix(920, 0)}, getSafeEventTimes(v.eventTimes, unflushed))
+	assert.Equal(t, v.eventTimes, getSafeEventTimes(v.eventTimes, nil))
+
+	//position behind cache keeps lag
+	v.setCommitted(getSafeEventTimes(v.eventTimes, unflushed))
+	assert.Equal(t, 50.0, v.getLag(now)[`shard1`])
+
+	v.checkLag()
+	assert.True(t, v.lagAlerted[`shard1`])
+	assert.False(t, v.lagAlerted[`shard2`])
+
+	v.setCommitted(v.eventTimes)
+	assert.Equal(t, map[string]float64{`shard1`: 0, `shard2`: 0}, v.getLag(now))
+}
+
+func TestEventTimeValue(t *testing.T) {
+	eventTimes := map[string]time.Time{`shard1`: time.Unix(980, 0)}
+
+	assert.Equal(t, `NULL`, eventTimeValue(eventTimes, `shard3`))
+	assert.Equal(t, `'`+formatTime(time.Unix(980, 0))+`'`, eventTimeValue(eventTimes, `shard1`))
+}
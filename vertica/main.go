@@ -4,57 +4,138 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	//include ODBC driver
-	_ "github.com/alexbrainman/odbc"
 
 	"github.com/b13f/repligator/ddlparser"
 	"github.com/b13f/repligator/isql"
 )
 
+//sql drivers
+const (
+	driverODBC   = "odbc"
+	driverNative = "vertica"
+)
+
 //Config is vertica server credentials and other params
 type Config struct {
-	Odbc       string
-	Host       string
-	Port       string
-	User       string
-	Password   string
-	Database   string
-	Pack       int
-	FlushCount int    `yaml:"flush_count"`
-	FlushTime  int    `yaml:"flush_time"`
-	DataDir    string `yaml:"data_dir"`
+	Driver       string //odbc or vertica
+	Odbc         string
+	Host         string
+	Port         string
+	User         string
+	Password     string
+	Database     string
+	Pack         int
+	FlushCount   int      `yaml:"flush_count"`
+	FlushTime    int      `yaml:"flush_time"`
+	FlushWorkers int      `yaml:"flush_workers"`
+	DataDir      string   `yaml:"data_dir"`
+	CopyPipe     bool     `yaml:"copy_pipe"`
+	CacheMemory  int      `yaml:"cache_memory"` //MB
+	SourceColumn string   `yaml:"source_column"`
+	MetaColumns  []string `yaml:"meta_columns"`
+	LagAlert     int      `yaml:"lag_alert"` //seconds
+	Tables       []TableConfig
 }
 
 //Cache is main struct to store cached events and vertica server params
 type Cache struct {
 	sync.Mutex
-	ODBCdsn    string
-	db         *sql.DB
-	tx         *sql.Tx
-	tables     map[string]tableCache
-	gtidSet    map[string]string
-	delPack    int
-	infoCache  string
-	dataDir    string
-	flushCount int
-	flushTime  int
+	ODBCdsn      string
+	driver       string
+	nativeDSN    string
+	db           *sql.DB
+	tx           *sql.Tx
+	tables       map[string]tableCache
+	gtidSet      map[string]string
+	delPack      int
+	infoCache    string
+	status       statusState
+	dataDir      string
+	copyPipe     bool
+	flushCount   int
+	flushTime    int
+	flushWorkers int
+	sourceColumn string
+	metaColumns  []string
+	memoryLimit  int                          //bytes of cached values before spill
+	spilled      bool                         //cache spilled and must be flushed
+	eventSeq     int                          //number of applied transactions
+	tablesPos    map[string]map[string]string //source to table to position of own table flush
+	eventTimes   map[string]time.Time         //source to binlog time of last transaction in cache
+	committed    map[string]time.Time         //source to binlog time of last written position
+	uncommitted  map[string]time.Time         //source to binlog time of oldest transaction in cache not written with position
+	lagAlert     int                          //seconds of lag to warn
+	lagAlerted   map[string]bool              //sources with lag over alert
+	heartbeatLag map[string]float64           //source to seconds of last heartbeat from write to commit
+	hbSchemas    map[string]string            //source to schema of its heartbeat table
+	sources      SourceController             //pause and resume of sources, nil if not set
+	ddl          ddlQueue                     //DDL waiting action
+	tablesConf   []TableConfig
 }
 
 //Init create vertica destination connection and return connect
 func Init(conf Config) (vertica *Cache, err error) {
+	vertica = New(conf)
+
+	if err = vertica.checkRequirements(); err != nil {
+		return
+	}
+
+	if err = vertica.removeSpills(); err != nil {
+		return
+	}
+
+	if err = vertica.loadTablePositions(); err != nil {
+		return
+	}
+
+	if err = vertica.migratePosition(); err != nil {
+		return
+	}
+
+	err = vertica.migrateSoftDelete()
+
+	return vertica, err
+}
+
+//New return vertica destination without connection, enough to generate DDL
+func New(conf Config) (vertica *Cache) {
 	vertica = new(Cache)
 	vertica.ODBCdsn = `Driver=` + conf.Odbc + `;Servername=` + conf.Host +
 		`;Database=` + conf.Database + `;Port=` + conf.Port +
 		`;uid=` + conf.User + `;pwd=` + conf.Password + `;`
 
+	if vertica.driver = conf.Driver; vertica.driver == "" {
+		vertica.driver = driverODBC
+	}
+
+	//simple queries, COPY can not be prepared
+	native := url.URL{
+		Scheme:   driverNative,
+		User:     url.UserPassword(conf.User, conf.Password),
+		Host:     conf.Host + `:` + conf.Port,
+		Path:     `/` + conf.Database,
+		RawQuery: `use_prepared_statements=0`,
+	}
+	vertica.nativeDSN = native.String()
+
 	vertica.tables = make(map[string]tableCache)
 	vertica.gtidSet = make(map[string]string)
+	vertica.tablesPos = make(map[string]map[string]string)
+	vertica.eventTimes = make(map[string]time.Time)
+	vertica.committed = make(map[string]time.Time)
+	vertica.uncommitted = make(map[string]time.Time)
+	vertica.lagAlerted = make(map[string]bool)
+	vertica.heartbeatLag = make(map[string]float64)
+	vertica.hbSchemas = make(map[string]string)
+	vertica.ddl.actions = make(chan ddlAction)
 	if vertica.delPack = conf.Pack; vertica.delPack == 0 {
 		vertica.delPack = 5000
 	}
@@ -64,10 +145,15 @@ func Init(conf Config) (vertica *Cache, err error) {
 
 	vertica.flushCount = conf.FlushCount
 	vertica.flushTime = conf.FlushTime
-
-	err = vertica.checkRequirements()
-
-	return vertica, err
+	vertica.flushWorkers = conf.FlushWorkers
+	vertica.copyPipe = conf.CopyPipe
+	vertica.memoryLimit = conf.CacheMemory * 1024 * 1024
+	vertica.sourceColumn = conf.SourceColumn
+	vertica.metaColumns = getMetaColumns(conf.MetaColumns)
+	vertica.tablesConf = conf.Tables
+	vertica.lagAlert = conf.LagAlert
+
+	return vertica
 }
 
 func (vc *Cache) checkRequirements() (err error) {
@@ -90,27 +176,31 @@ func (vc *Cache) checkRequirements() (err error) {
 		_, err = vc.db.Exec(createSQL)
 	}
 
+	if err == nil {
+		_, err = vc.db.Exec(tablePosCreateSQL)
+	}
+
+	if err == nil {
+		_, err = vc.db.Exec(ddlAuditCreateSQL)
+	}
+
 	return
 }
 
 //GetHTTPInterfaces return http handlers
-func (vc *Cache) GetHTTPInterfaces(skip chan string) map[string]func(w http.ResponseWriter, r *http.Request) {
+func (vc *Cache) GetHTTPInterfaces() map[string]func(w http.ResponseWriter, r *http.Request) {
 	ret := make(map[string]func(w http.ResponseWriter, r *http.Request))
 
 	ret[`/skip`] = func(w http.ResponseWriter, r *http.Request) {
-		if vc.isCacheExist() {
-			fmt.Fprint(w, `Can not skip transaction! Cache is not cleared.`)
-			return
-		}
+		fmt.Fprint(w, vc.skipDDLMessage(r.URL.Query().Get(`gtid`)))
+	}
 
-		select {
-		case info := <-skip:
-			log.Infof(`Transaction: %s skipped`, info)
-			fmt.Fprintf(w, `Transaction: %s skipped`, info)
-		default:
-			fmt.Fprint(w, `Nothing to skip`)
-		}
+	ret[`/pause`] = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, vc.controlSource(`pause`, r.URL.Query().Get(`source`)))
+	}
 
+	ret[`/resume`] = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, vc.controlSource(`resume`, r.URL.Query().Get(`source`)))
 	}
 
 	ret[`/info`] = func(w http.ResponseWriter, r *http.Request) {
@@ -126,21 +216,11 @@ func (vc *Cache) GetHTTPInterfaces(skip chan string) map[string]func(w http.Resp
 }
 
 //GetBotInterfaces return handlers for bot realisations
-func (vc *Cache) GetBotInterfaces(skip chan string) map[string]func(msg string) string {
+func (vc *Cache) GetBotInterfaces() map[string]func(msg string) string {
 	ret := make(map[string]func(msg string) string)
 
 	ret[`skip`] = func(msg string) string {
-		if vc.isCacheExist() {
-			return `Can not skip transaction! Cache is not cleared.`
-		}
-
-		select {
-		case info := <-skip:
-			log.Infof(`Transaction: %s skipped`, info)
-			return fmt.Sprintf(`Transaction: %s skipped`, info)
-		default:
-			return `Nothing to skip`
-		}
+		return vc.skipDDLMessage(strings.TrimSpace(strings.TrimPrefix(msg, `skip`)))
 	}
 
 	ret[`vsql`] = func(msg string) string {
@@ -155,13 +235,71 @@ func (vc *Cache) GetBotInterfaces(skip chan string) map[string]func(msg string)
 		return `vsql done`
 	}
 
+	ret[`ddl`] = func(msg string) string {
+		var out string
+
+		for _, ddl := range vc.GetPendingDDL() {
+			out += fmt.Sprintf("[%s] %s\nquery: %s\nvsql: %s\nerror: %s\n", ddl.Source, ddl.Gtid, ddl.Query, strings.Join(ddl.Vsql, ";"), ddl.Error)
+		}
+
+		if out == "" {
+			return `No pending DDL`
+		}
+
+		return out
+	}
+
+	ret[`retry`] = func(msg string) string {
+		return vc.resolveDDLMessage(strings.TrimSpace(strings.TrimPrefix(msg, `retry`)), DDLRetry, nil)
+	}
+
+	//apply <gtid> <vsql>;<vsql>
+	ret[`apply`] = func(msg string) string {
+		args := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(msg, `apply`)), ` `, 2)
+		if len(args) < 2 {
+			return `Usage: apply <gtid> <vsql>`
+		}
+
+		return vc.resolveDDLMessage(args[0], DDLApply, SplitStatements(args[1]))
+	}
+
+	//replace <gtid> <vsql>;<vsql>
+	ret[`replace`] = func(msg string) string {
+		args := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(msg, `replace`)), ` `, 2)
+		if len(args) < 2 {
+			return `Usage: replace <gtid> <vsql>;<vsql>`
+		}
+
+		return vc.resolveDDLMessage(args[0], DDLReplace, SplitStatements(args[1]))
+	}
+
+	ret[`pause`] = func(msg string) string {
+		return vc.controlSource(`pause`, strings.TrimSpace(strings.TrimPrefix(msg, `pause`)))
+	}
+
+	ret[`resume`] = func(msg string) string {
+		return vc.controlSource(`resume`, strings.TrimSpace(strings.TrimPrefix(msg, `resume`)))
+	}
+
+	ret[`lag`] = func(msg string) string {
+		vc.Lock()
+		defer vc.Unlock()
+
+		if info := vc.getLagInfo() + vc.getHeartbeatInfo(); info != "" {
+			return info
+		}
+
+		return `No committed positions`
+	}
+
 	return ret
 }
 
-//ApplyEvent receive events to store in vertica
-func (vc *Cache) ApplyEvent(receiver chan interface{}, skip chan string) chan error {
+//ApplyEvent receive events to store in vertica, true stops receiving and flushes cache, result sent to returned chan
+func (vc *Cache) ApplyEvent(receiver chan interface{}) chan error {
 	var replicationEvent interface{}
-	fatalError := make(chan error)
+	//result of final flush not waited by all receivers
+	fatalError := make(chan error, 1)
 
 	var counter int
 	var start = time.Now()
@@ -173,6 +311,7 @@ func (vc *Cache) ApplyEvent(receiver chan interface{}, skip chan string) chan er
 	}
 
 	var err error
+	vc.setLoopTime(false)
 	go func() {
 	MainLoop:
 		for {
@@ -182,6 +321,9 @@ func (vc *Cache) ApplyEvent(receiver chan interface{}, skip chan string) chan er
 				replicationEvent = nil
 			}
 
+			vc.setLoopTime(false)
+			vc.checkLag()
+
 			switch event := replicationEvent.(type) {
 			case isql.RowsEvent:
 				if err = vc.setRows(event); err != nil {
@@ -191,7 +333,7 @@ func (vc *Cache) ApplyEvent(receiver chan interface{}, skip chan string) chan er
 				counter++
 			case isql.DdlEvent:
 				//ddl
-				if counter > 0 {
+				if counter > 0 || vc.hasPending() {
 					if err = vc.clearCache(); err != nil {
 						log.Errorf(`Clear cache error: %s`, err.Error())
 						fatalError <- err
@@ -206,50 +348,106 @@ func (vc *Cache) ApplyEvent(receiver chan interface{}, skip chan string) chan er
 					log.Debugf("DDL: %v", vsql)
 				}
 
-				//wait skip if some errors
+				outcome, record := ddlOutcomeApplied, newPendingDDL(event, vsql, err)
+				if len(vsql) == 0 {
+					outcome = ddlOutcomeIgnored
+				}
+
+				//wait skip, retry or custom vsql by gtid if some errors
 				if err != nil {
 					log.Warnf("Error: %s Vsql: %s Real sql %s", err.Error(), vsql, event.GetQuery())
-					skip <- event.GetQuery()
+					vc.recordFailedDDL(record)
+
+					var positioned bool
+					//replaced ddl written with position
+					if outcome, record, positioned = vc.waitDDL(event, record); positioned {
+						continue
+					}
 				}
 
-				//write position of current ddl
-				vc.Lock()
-				t := vc.gtidSet
-				t[event.GetSourceName()] = event.GetGtidSet()
-				vc.gtidSet = t
-				vc.Unlock()
+				//write history and position of current ddl, applied DDL without position is applied again after restart
+				if err = vc.flushDDLPosition(event, record, outcome); err != nil {
+					log.Errorf(`Set pos error: %s`, err.Error())
+					fatalError <- err
+				}
 
-				if err = vc.flushPosition(); err != nil {
-					log.Warnf(`Set pos error: %s`, err.Error())
+				continue
+			case isql.FlushEvent:
+				//write events applied before with position
+				if counter > 0 || vc.hasPending() {
+					if err = vc.clearCache(); err != nil {
+						log.Errorf(`Clear cache error: %s`, err.Error())
+					} else {
+						counterReset()
+					}
 				}
 
+				event.Done <- err
+				err = nil
 				continue
 			case bool:
 				break MainLoop
 			case nil:
 			}
 
-			if counter == vc.flushCount || (time.Since(start).Seconds() > float64(vc.flushTime) && counter > 0) {
-				if err = vc.flushCache(); err != nil {
-					log.Errorf(`Flush error: %s`, err.Error())
+			//spilled cache flushed whole, global policy skips tables with own policy not due yet
+			var names []string
+			global := counter == vc.flushCount || (time.Since(start).Seconds() > float64(vc.flushTime) && counter > 0) || (vc.spilled && counter > 0)
+
+			switch {
+			case vc.spilled && counter > 0:
+				names = vc.getTableNames()
+			case global:
+				names = vc.getGlobalTables()
+			default:
+				if names = vc.getDueTables(); len(names) == 0 {
+					continue
+				}
+			}
+
+			if err = vc.flushCache(names); err != nil {
+				log.Errorf(`Flush error: %s`, err.Error())
 
-					f, _ := os.OpenFile(vc.dataDir+`debug`, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-					f.Close()
+				f, _ := os.OpenFile(vc.dataDir+`debug`, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+				f.Close()
 
-					fatalError <- err
-				}
+				fatalError <- err
+			}
 
+			if global {
 				counterReset()
 			}
 
 		}
+
+		//stopped by receiver, cached changes written with position
+		if counter > 0 || vc.hasPending() {
+			if err = vc.clearCache(); err != nil {
+				log.Errorf(`Clear cache error: %s`, err.Error())
+			} else {
+				counterReset()
+			}
+		}
+
+		fatalError <- err
 	}()
 
 	return fatalError
 }
 
 func (vc *Cache) getDDLFromEvent(event isql.DdlEvent) (vsql []string, err error) {
-	switch ddl := ddlparser.Ddlcase(event.GetQuery(), event.GetSchema()).(type) {
+	parsed := event.GetDdl()
+	if parsed == nil {
+		parsed = ddlparser.Ddlcase(event.GetQuery(), event.GetSchema())
+	}
+
+	if event.IsMerge() {
+		if parsed, err = vc.mergeDDL(parsed); err != nil {
+			return
+		}
+	}
+
+	switch ddl := parsed.(type) {
 	case isql.CreateSchema:
 		vsql = vc.getSchemaSQL(ddl)
 	case isql.CreateTable:
@@ -261,7 +459,11 @@ func (vc *Cache) getDDLFromEvent(event isql.DdlEvent) (vsql []string, err error)
 	case isql.AlterTable:
 		vsql, err = vc.getAlterSQL(ddl)
 	case isql.TruncateTable:
-		vsql = vc.getTruncateSQL(ddl)
+		if event.IsMerge() {
+			vsql = vc.getSourceTruncateSQL(ddl, event.GetSourceName())
+		} else {
+			vsql = vc.getTruncateSQL(ddl)
+		}
 	case []isql.DropTable:
 		vsql = vc.GetDropSQL(ddl)
 	case error:
@@ -309,20 +511,34 @@ func (vc *Cache) Exec(vsqls []string) (aff int64, err error) {
 		}
 
 		if aff == 0 {
-			log.Warnf("Affected 0: %s", vsql[:40])
+			log.Warnf("Affected 0: %.40s", vsql)
 		}
 	}
 
 	return
 }
 
+//return sql driver name and dsn
+func (vc *Cache) getDriver() (string, string) {
+	if vc.driver == driverNative {
+		return driverNative, vc.nativeDSN
+	}
+
+	return driverODBC, vc.ODBCdsn
+}
+
 func (vc *Cache) getDb() (err error) {
-	if vc.db, err = sql.Open("odbc", vc.ODBCdsn); err != nil {
+	if vc.db, err = sql.Open(vc.getDriver()); err != nil {
 		return
 	}
 	// no need to have more then one connection
 	vc.db.SetMaxOpenConns(1)
 
+	//stage workers and flush transaction
+	if vc.isParallel() {
+		vc.db.SetMaxOpenConns(vc.flushWorkers + 1)
+	}
+
 	return
 }
 
@@ -337,7 +553,16 @@ func (vc *Cache) GetTablesCacheInfo(debug bool) string {
 		out += fmt.Sprintf("gtid: [%s] %s\n", name, set)
 	}
 
-	tpl := "\n Table: %s\n DELS: %d\n INS: %d\n"
+	if vc.sources != nil && len(vc.sources.Paused()) > 0 {
+		out += fmt.Sprintf("paused: %s\n", strings.Join(vc.sources.Paused(), ","))
+	}
+
+	out += vc.getLagInfo()
+	out += vc.getHeartbeatInfo()
+
+	out += fmt.Sprintf("memory: %d of %d bytes\n", vc.cacheMemory(), vc.memoryLimit)
+
+	tpl := "\n Table: %s\n DELS: %d\n SOFT DELS: %d\n MERGE DELS: %d\n INS: %d\n HISTORY: %d\n SPILLS: %d\n ROWS: %d\n"
 
 	tplExt := " Columns: %s\n Enums: %d\n mConstr: %q\n mKeySort: %q\n"
 
@@ -348,7 +573,7 @@ func (vc *Cache) GetTablesCacheInfo(debug bool) string {
 			t[table.schema+`.`+table.name] = len(table.tDels)
 		}
 
-		out += fmt.Sprintf(tpl, table.schema+`.`+table.name, len(table.tDels), len(table.tIns))
+		out += fmt.Sprintf(tpl, table.schema+`.`+table.name, len(table.tDels), len(table.tSoftDels), len(table.mDels), len(table.tIns), table.history.len(), len(table.spills), table.rows)
 
 		if debug {
 			out += fmt.Sprintf("\n dels: %+v \n ins: %+v\n", table.tDels, table.tIns)
@@ -375,34 +600,92 @@ func (vc *Cache) isCacheExist() bool {
 	return ex
 }
 
-func (vc *Cache) flushCacheExec() (err error) {
-	vc.analyze()
+//write cached changes of tables, position before oldest change left in cache
+func (vc *Cache) flushCacheExec(names []string) (err error) {
+	unflushed := vc.getUnflushed(names)
+	full := len(unflushed) == 0
+	heartbeats := make(map[string]int64)
+	flushed := make(map[string]tableCache, len(names))
+
+	vc.analyze(names)
+	if vc.isParallel() {
+		if err = vc.stageTablesExec(names); err != nil {
+			return
+		}
+	}
 	if err = vc.startTx(); err != nil {
 		return
 	}
-	for i, table := range vc.tables {
+	//cache and spill files kept on error, flush retried with the same changes
+	defer func() {
+		if err != nil {
+			vc.rollbackTx()
+		}
+	}()
+	for _, i := range names {
+		table := vc.tables[i]
+
+		if err = table.tableSpillsExec(vc); err != nil {
+			return
+		}
 		if err = table.tableDeletesExec(vc); err != nil {
 			return
 		}
+		if err = table.tableSoftDeletesExec(vc); err != nil {
+			return
+		}
+		if err = table.tableMergeExec(vc); err != nil {
+			return
+		}
 		if err = table.tableInsertsExec(vc); err != nil {
 			return
 		}
+		if err = table.tableHistoryExec(vc); err != nil {
+			return
+		}
 
-		vc.tables[i] = table
+		for source, ts := range table.heartbeats {
+			heartbeats[source] = ts
+		}
+
+		table.memory = 0
+		table.preStaged = false
+		table.heartbeats = nil
+		table.resetPending()
+		flushed[i] = table
 	}
-	if err = vc.flushPosition(); err != nil {
+	eventTimes := getSafeEventTimes(vc.eventTimes, unflushed)
+	if err = vc.writePosition(getSafePosition(vc.gtidSet, unflushed), eventTimes); err != nil {
+		return
+	}
+	if full {
+		err = vc.clearTablePositions()
+	} else {
+		err = vc.flushTablePositions(names)
+	}
+	if err != nil {
 		return
 	}
 	if err = vc.commitTx(); err != nil {
 		return
 	}
 
+	for i, table := range flushed {
+		table.removeSpillFiles()
+		vc.tables[i] = table
+	}
+
+	vc.setTablePositions(names, full)
+	vc.setCommitted(eventTimes)
+	vc.setHeartbeats(heartbeats, time.Now())
+	vc.spilled = vc.spilled && !full
+
 	return
 }
 
 //flush & clear tables cache
 func (vc *Cache) clearCache() (err error) {
-	if err = vc.flushCache(); err != nil {
+	if err = vc.flushCache(vc.getTableNames()); err != nil {
 		return
 	}
 	vc.Lock()
@@ -412,24 +695,36 @@ func (vc *Cache) clearCache() (err error) {
 }
 
 //write tables data
-func (vc *Cache) flushCache() (err error) {
+func (vc *Cache) flushCache(names []string) (err error) {
 	vc.infoCache = vc.GetTablesCacheInfo(false)
 
+	start := time.Now()
+	vc.startFlushStatus(start)
+
+	defer func() {
+		vc.endFlushStatus(start, len(names), err)
+	}()
+
 	vc.Lock()
 	defer vc.Unlock()
 
-	if err = vc.flushCacheExec(); err != nil {
+	if err = vc.flushCacheExec(names); err != nil {
+		flushErrors.Inc()
 		return
 	}
 	vc.infoCache = ""
 
+	flushDuration.Observe(time.Since(start).Seconds())
+	vc.setCacheMetrics()
+
 	return
 }
 
-func (vc *Cache) analyze() (err error) {
+func (vc *Cache) analyze(names []string) (err error) {
 	var queries []string
 
-	for _, table := range vc.tables {
+	for _, name := range names {
+		table := vc.tables[name]
 		queries = append(queries, table.analyzeStatisticsQuery())
 	}
 
@@ -454,6 +749,13 @@ func (vc *Cache) commitTx() (err error) {
 	return
 }
 
+func (vc *Cache) rollbackTx() {
+	if vc.tx != nil {
+		vc.tx.Rollback()
+		vc.tx = nil
+	}
+}
+
 func (vc *Cache) forceExec(expression string) (result sql.Result, err error) {
 	if vc.tx != nil {
 		result, err = vc.tx.Exec(expression)
@@ -488,16 +790,25 @@ func (vc *Cache) getTableEnumValues(schema, table string) (enums []enum, err err
 	return
 }
 
-var updateSQL = `UPDATE public."__repligator_pos" SET gtid='%s',"timestamp"=NOW() WHERE name='%s'`
-var insertSQL = `INSERT INTO public."__repligator_pos"(name,gtid,"timestamp") VALUES ('%s','%s',NOW())`
+var updateSQL = `UPDATE public."__repligator_pos" SET gtid='%s',event_time=%s,"timestamp"=NOW() WHERE name='%s'`
+var insertSQL = `INSERT INTO public."__repligator_pos"(name,gtid,event_time,"timestamp") VALUES ('%s','%s',%s,NOW())`
 
 //write saved transaction gtid in vsql destination
 func (vc *Cache) flushPosition() (err error) {
+	if err = vc.writePosition(vc.gtidSet, vc.eventTimes); err == nil {
+		vc.setCommitted(vc.eventTimes)
+	}
+
+	return
+}
+
+//write gtid sets of sources in vsql destination
+func (vc *Cache) writePosition(gtidSet map[string]string, eventTimes map[string]time.Time) (err error) {
 	var res sql.Result
 	var aff int64
 
-	for sourceName, set := range vc.gtidSet {
-		if res, err = vc.forceExec(fmt.Sprintf(updateSQL, set, sourceName)); err != nil {
+	for sourceName, set := range gtidSet {
+		if res, err = vc.forceExec(fmt.Sprintf(updateSQL, set, eventTimeValue(eventTimes, sourceName), sourceName)); err != nil {
 			return
 		}
 
@@ -506,7 +817,7 @@ func (vc *Cache) flushPosition() (err error) {
 		}
 
 		if aff == 0 {
-			if _, err = vc.forceExec(fmt.Sprintf(insertSQL, sourceName, set)); err != nil {
+			if _, err = vc.forceExec(fmt.Sprintf(insertSQL, sourceName, set, eventTimeValue(eventTimes, sourceName))); err != nil {
 				return err
 			}
 		}
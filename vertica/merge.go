@@ -0,0 +1,193 @@
+package vertica
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//table flush strategies
+const (
+	flushCopy  = "copy"
+	flushMerge = "merge"
+)
+
+//staging tables of merge flush
+const (
+	stageSuffix    = "__stage"
+	stageDelSuffix = "__stage_del"
+)
+
+var stageDropTmpl = `DROP TABLE IF EXISTS "%s"."%s" CASCADE`
+
+var stageCreateTmpl = `CREATE TABLE "%s"."%s" AS SELECT %s FROM "%s"."%s" LIMIT 0`
+
+//check table is merge staging table
+func isStageTable(table string) bool {
+	return strings.HasSuffix(table, stageSuffix) || strings.HasSuffix(table, stageDelSuffix)
+}
+
+//enable merge flush if table allow it, parallel flush loads keyed tables through stage too
+func (vc *Cache) initStage(t *tableCache) (err error) {
+	merge := vc.getTableConfig(t.schema, t.name).Flush == flushMerge
+
+	//merge upsert by key, deleted versions duplicate keys
+	if merge && (len(t.leadConstrColNames) == 0 || t.softDelete) {
+		log.Warnf("Merge flush of %s.%s needs primary or unique key and no soft delete, copy used", t.schema, t.name)
+		merge = false
+	}
+
+	if !merge && (vc.flushWorkers < 2 || len(t.leadConstrColNames) == 0) {
+		return
+	}
+
+	//stage recreated on every table cache init to follow alters
+	for _, vsql := range t.getStageSQL() {
+		if _, err = vc.db.Exec(vsql); err != nil {
+			return
+		}
+	}
+
+	t.staged = true
+
+	if merge {
+		t.merge = true
+		t.mDels = make(map[string]string)
+	}
+
+	return
+}
+
+//return statements to recreate staging tables
+func (t *tableCache) getStageSQL() []string {
+	return []string{
+		fmt.Sprintf(stageDropTmpl, t.schema, t.name+stageSuffix),
+		fmt.Sprintf(stageDropTmpl, t.schema, t.name+stageDelSuffix),
+		fmt.Sprintf(stageCreateTmpl, t.schema, t.name+stageSuffix, `*`, t.schema, t.name),
+		fmt.Sprintf(stageCreateTmpl, t.schema, t.name+stageDelSuffix, `"`+strings.Join(t.keyNames(), `","`)+`"`, t.schema, t.name),
+	}
+}
+
+//return statements to empty staging tables, they may have rows of failed flush
+func (t *tableCache) getStageClearSQL() []string {
+	return []string{
+		fmt.Sprintf(`DELETE FROM "%s"."%s"`, t.schema, t.name+stageSuffix),
+		fmt.Sprintf(`DELETE FROM "%s"."%s"`, t.schema, t.name+stageDelSuffix),
+	}
+}
+
+//return key columns names in table order
+func (t *tableCache) keyNames() (names []string) {
+	for _, n := range t.leadConstrColOrder {
+		names = append(names, t.columnNames[n])
+	}
+
+	return
+}
+
+//add deleted key to merge stage
+func (t *tableCache) addMergeDel(row []interface{}) {
+	t.setMergeDel(t.generateKey(row), generateRowCopy(t.keyValues(row)))
+}
+
+//return statements to apply staging tables to table
+func (t *tableCache) getMergeSQL(dels, ins bool) (vsqls []string) {
+	stage := fmt.Sprintf(`"%s"."%s"`, t.schema, t.name+stageSuffix)
+	stageDel := fmt.Sprintf(`"%s"."%s"`, t.schema, t.name+stageDelSuffix)
+
+	var on, delOn, set, values []string
+
+	for _, name := range t.keyNames() {
+		on = append(on, fmt.Sprintf(`t."%s"=s."%s"`, name, name))
+		delOn = append(delOn, fmt.Sprintf(`"%s"."%s"."%s"=s."%s"`, t.schema, t.name, name, name))
+	}
+
+	for i, name := range t.columnNames {
+		//key columns are matched, not updated
+		if pos, ok := t.leadConstrColNames[name]; !ok || pos != i {
+			set = append(set, fmt.Sprintf(`"%s"=s."%s"`, name, name))
+		}
+		values = append(values, fmt.Sprintf(`s."%s"`, name))
+	}
+
+	if dels {
+		vsqls = append(vsqls, fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE EXISTS (SELECT 1 FROM %s s WHERE %s)`,
+			t.schema, t.name, stageDel, strings.Join(delOn, ` AND `)))
+	}
+
+	if ins {
+		var matched string
+		if len(set) > 0 {
+			matched = "\n\t\tWHEN MATCHED THEN UPDATE SET " + strings.Join(set, `,`)
+		}
+
+		vsqls = append(vsqls, fmt.Sprintf(`MERGE INTO "%s"."%s" t USING %s s ON %s%s
+		WHEN NOT MATCHED THEN INSERT ("%s") VALUES (%s)`,
+			t.schema, t.name, stage, strings.Join(on, ` AND `), matched,
+			strings.Join(t.columnNames, `","`), strings.Join(values, `,`)))
+	}
+
+	return
+}
+
+//load batch into staging tables and merge it
+func (t *tableCache) tableMergeExec(vert *Cache) (err error) {
+	if !t.merge || (len(t.tIns) == 0 && len(t.mDels) == 0) {
+		return
+	}
+
+	log.Debugf("Start merge %s.%s: %d upserts, %d dels", t.schema, t.name, len(t.tIns), len(t.mDels))
+
+	//parallel flush loaded stage before
+	if !t.preStaged {
+		if err = t.stageLoadExec(vert); err != nil {
+			return
+		}
+	}
+
+	if _, err = vert.Exec(t.getMergeSQL(len(t.mDels) > 0, len(t.tIns) > 0)); err != nil {
+		return
+	}
+
+	t.tIns = make(map[string]string)
+	t.mDels = make(map[string]string)
+
+	return
+}
+
+//load cached deletes and inserts into staging tables
+func (t *tableCache) stageLoadExec(vert *Cache) (err error) {
+	if _, err = vert.Exec(t.getStageClearSQL()); err != nil {
+		return
+	}
+
+	dels := t.mDels
+	if !t.merge {
+		dels = t.tDelKeys
+	}
+
+	if len(dels) > 0 {
+		lines := make([]string, 0, len(dels))
+		for _, val := range dels {
+			lines = append(lines, val)
+		}
+
+		if err = vert.copyLines(t.schema, t.name+stageDelSuffix, nil, lines); err != nil {
+			return
+		}
+	}
+
+	if len(t.tIns) > 0 {
+		lines := make([]string, 0, len(t.tIns))
+		for _, val := range t.tIns {
+			lines = append(lines, val)
+		}
+
+		if err = vert.copyLines(t.schema, t.name+stageSuffix, nil, lines); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,50 @@
+package vertica
+
+import (
+	"testing"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeCache(t *testing.T) {
+	table := newKeyTable(`merge`, `id`, `val`)
+	table.merge = true
+	table.mDels = make(map[string]string)
+
+	upd := rowsChange{op: isql.Update}
+	del := rowsChange{op: isql.Delete}
+
+	table.addDel(nil, upd, [][]interface{}{{1, `a`}})
+	assert.NoError(t, table.addIns(nil, upd, [][]interface{}{{1, `b`}}))
+	table.addDel(nil, del, [][]interface{}{{2, `c`}})
+
+	assert.Equal(t, map[string]string{`2`: `"2"`}, table.mDels)
+	assert.Equal(t, 1, len(table.tIns))
+	assert.Empty(t, table.tDels)
+
+	assert.Equal(t, []string{
+		`CREATE TABLE "testing"."merge__stage" AS SELECT * FROM "testing"."merge" LIMIT 0`,
+		`CREATE TABLE "testing"."merge__stage_del" AS SELECT "id" FROM "testing"."merge" LIMIT 0`,
+	}, table.getStageSQL()[2:])
+
+	assert.Equal(t, []string{
+		`DELETE FROM "testing"."merge" WHERE EXISTS (SELECT 1 FROM "testing"."merge__stage_del" s WHERE "testing"."merge"."id"=s."id")`,
+		`MERGE INTO "testing"."merge" t USING "testing"."merge__stage" s ON t."id"=s."id"
+		WHEN MATCHED THEN UPDATE SET "val"=s."val"
+		WHEN NOT MATCHED THEN INSERT ("id","val") VALUES (s."id",s."val")`,
+	}, table.getMergeSQL(true, true))
+}
+
+func TestMergeAlter(t *testing.T) {
+	_, err := New(Config{}).mergeDDL(isql.AlterTable{Table: isql.Table{Schema: `sales`, Name: `orders`}})
+	assert.EqualError(t, err, `ALTER of merged table sales.orders has no column or key changes`)
+
+	table := tableCache{
+		columnNames: []string{`id`, `Foo`},
+		constraints: []constraint{{constraintType: "u", columnsPositionMap: map[string]int{`Foo`: 1}}},
+	}
+	assert.True(t, table.hasColumn(`foo`))
+	assert.False(t, table.hasColumn(`bar`))
+	assert.True(t, table.hasConstraint(isql.Unique, []string{`FOO`}))
+}
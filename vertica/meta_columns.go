@@ -0,0 +1,70 @@
+package vertica
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+//change metadata columns
+const (
+	gtidColumn     = "_gtid"
+	binlogTsColumn = "_binlog_ts"
+	opColumn       = "_op"
+)
+
+//types of metadata columns
+var metaColumnTypes = map[string]string{
+	gtidColumn:     "VARCHAR(1024)",
+	binlogTsColumn: "TIMESTAMPTZ",
+	opColumn:       "VARCHAR(10)",
+}
+
+//return known metadata columns in config order
+func getMetaColumns(names []string) (columns []string) {
+	for _, name := range names {
+		if _, ok := metaColumnTypes[name]; !ok {
+			log.Warnf("Unknown meta column %s skipped", name)
+			continue
+		}
+
+		columns = append(columns, name)
+	}
+
+	return
+}
+
+func (vc *Cache) isMetaColumn(name string) bool {
+	for _, column := range vc.metaColumns {
+		if column == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+//metadata differs between versions of same row, so row identity is without it
+func (t *tableCache) withoutMeta(row []interface{}) []interface{} {
+	if len(t.metaColumns) == 0 {
+		return row
+	}
+
+	clean := append([]interface{}{}, row...)
+
+	for _, pos := range t.metaColumns {
+		if pos < len(clean) {
+			clean[pos] = nil
+		}
+	}
+
+	return clean
+}
+
+func (t *tableCache) isMetaPosition(pos int) bool {
+	for _, p := range t.metaColumns {
+		if p == pos {
+			return true
+		}
+	}
+
+	return false
+}
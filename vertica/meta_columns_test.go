@@ -0,0 +1,30 @@
+package vertica
+
+import (
+	"testing"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaColumnsCache(t *testing.T) {
+	v := New(Config{MetaColumns: []string{gtidColumn, opColumn}})
+
+	//without key rows are deleted by all columns
+	table := newKeyTable(`meta`, `val`, gtidColumn, opColumn)
+	table.leadConstrColNames, table.leadConstrColOrder = nil, nil
+	table.extraColumns = []extraColumn{{name: gtidColumn, pos: 1}, {name: opColumn, pos: 2}}
+	table.metaColumns = []int{1, 2}
+
+	ins := rowsChange{gtid: `uuid:1`, op: isql.Insert}
+	del := rowsChange{gtid: `uuid:2`, op: isql.Delete}
+
+	assert.NoError(t, table.addIns(v.getExtraValues(ins), ins, [][]interface{}{{`a`}, {`b`}}))
+	table.addDel(v.getExtraValues(del), del, [][]interface{}{{`a`}, {`c`}})
+
+	assert.Equal(t, 1, len(table.tIns))
+	for _, val := range table.tIns {
+		assert.Equal(t, `"b","uuid:1","insert"`, val)
+	}
+	assert.Equal(t, []string{`DELETE FROM "testing"."meta" WHERE "val"='c'`}, table.tDels)
+}
@@ -0,0 +1,59 @@
+package vertica
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	transactionsApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repligator_transactions_applied_total",
+		Help: "Transactions applied to cache.",
+	}, []string{"source"})
+
+	rowsApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repligator_rows_total",
+		Help: "Rows inserted, updated and deleted in cache by table.",
+	}, []string{"table", "op"})
+
+	flushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "repligator_flush_duration_seconds",
+		Help:    "Duration of cache flush.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+
+	flushErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "repligator_flush_errors_total",
+		Help: "Failed cache flushes.",
+	})
+
+	cacheMemory = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "repligator_cache_memory_bytes",
+		Help: "Approximate size of cached values.",
+	})
+
+	cacheRows = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "repligator_cache_rows",
+		Help: "Changed rows cached since flush.",
+	})
+
+	ddlSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "repligator_ddl_skipped_total",
+		Help: "Not applied DDL statements skipped by user.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(transactionsApplied, rowsApplied, flushDuration, flushErrors, cacheMemory, cacheRows, ddlSkipped)
+}
+
+//update cache size metrics, cache locked
+func (vc *Cache) setCacheMetrics() {
+	var rows int
+
+	for _, table := range vc.tables {
+		rows += table.rows
+	}
+
+	cacheMemory.Set(float64(vc.cacheMemory()))
+	cacheRows.Set(float64(rows))
+}
@@ -0,0 +1,111 @@
+package vertica
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//check tables are loaded into stage concurrently before flush transaction
+func (vc *Cache) isParallel() bool {
+	return vc.flushWorkers > 1
+}
+
+//return destination with own transaction on shared connections pool
+func (vc *Cache) worker() *Cache {
+	return &Cache{db: vc.db, dataDir: vc.dataDir, delPack: vc.delPack, copyPipe: vc.copyPipe}
+}
+
+//load staged tables concurrently, each table in own committed transaction
+func (vc *Cache) stageTablesExec(names []string) (err error) {
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+
+	tables := make(chan tableCache)
+
+	for i := 0; i < vc.flushWorkers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			w := vc.worker()
+
+			for table := range tables {
+				if werr := table.stageWorkerExec(w); werr != nil {
+					errMu.Lock()
+					if err == nil {
+						err = fmt.Errorf(`stage %s.%s: %s`, table.schema, table.name, werr.Error())
+					}
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, name := range vc.getStageTables(names) {
+		tables <- vc.tables[name]
+	}
+
+	close(tables)
+	wg.Wait()
+
+	return
+}
+
+//mark tables loaded into stage before flush transaction, spilled segments are merged through same stage in transaction
+func (vc *Cache) getStageTables(names []string) (staged []string) {
+	for _, name := range names {
+		table := vc.tables[name]
+		table.preStaged = table.staged && len(table.spills) == 0 && (len(table.tIns) > 0 || len(table.tDelKeys) > 0 || len(table.mDels) > 0)
+		vc.tables[name] = table
+
+		if table.preStaged {
+			staged = append(staged, name)
+		}
+	}
+
+	return
+}
+
+func (t *tableCache) stageWorkerExec(w *Cache) (err error) {
+	log.Debugf("Start stage %s.%s: %d ins", t.schema, t.name, len(t.tIns))
+
+	if err = w.startTx(); err != nil {
+		return
+	}
+
+	if err = t.stageLoadExec(w); err != nil {
+		w.tx.Rollback()
+		w.tx = nil
+		return
+	}
+
+	return w.commitTx()
+}
+
+//return delete by join with staged keys
+func (t *tableCache) getStageDelSQL() string {
+	var on []string
+
+	for _, name := range t.keyNames() {
+		on = append(on, fmt.Sprintf(`"%s"."%s"."%s"=s."%s"`, t.schema, t.name, name, name))
+	}
+
+	vsql := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE EXISTS (SELECT 1 FROM "%s"."%s" s WHERE %s)`,
+		t.schema, t.name, t.schema, t.name+stageDelSuffix, strings.Join(on, ` AND `))
+
+	//deleted versions stay
+	if t.softDelete {
+		vsql += fmt.Sprintf(` AND "%s"=false`, deletedColumn)
+	}
+
+	return vsql
+}
+
+//return insert of staged rows
+func (t *tableCache) getStageInsSQL() string {
+	return fmt.Sprintf(`INSERT INTO "%s"."%s" SELECT * FROM "%s"."%s"`, t.schema, t.name, t.schema, t.name+stageSuffix)
+}
@@ -0,0 +1,46 @@
+package vertica
+
+import (
+	"testing"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageCache(t *testing.T) {
+	table := newKeyTable(`stage`, `id`, `val`)
+	table.staged = true
+
+	table.addDel(nil, rowsChange{op: isql.Delete}, [][]interface{}{{1, `a`}})
+
+	assert.Equal(t, map[string]string{`1`: `"1"`}, table.tDelKeys)
+	assert.Equal(t, `DELETE FROM "testing"."stage" WHERE EXISTS (SELECT 1 FROM "testing"."stage__stage_del" s WHERE "testing"."stage"."id"=s."id")`, table.getStageDelSQL())
+	assert.Equal(t, `INSERT INTO "testing"."stage" SELECT * FROM "testing"."stage__stage"`, table.getStageInsSQL())
+}
+
+func TestStageSpilledMerge(t *testing.T) {
+	v := New(Config{})
+	v.flushWorkers = 2
+
+	for _, name := range []string{`spilled`, `cached`} {
+		table := newKeyTable(name, `id`, `val`)
+		table.mDels = make(map[string]string)
+		table.merge, table.staged = true, true
+		v.tables[`testing`+name] = table
+	}
+
+	spilled := v.tables[`testingspilled`]
+	assert.NoError(t, spilled.addIns(nil, rowsChange{op: isql.Insert}, [][]interface{}{{1, `a`}}))
+	spilled.spills = []spillSegment{{ins: 1}}
+	assert.NoError(t, spilled.addIns(nil, rowsChange{op: isql.Insert}, [][]interface{}{{2, `b`}}))
+	v.tables[`testingspilled`] = spilled
+
+	cached := v.tables[`testingcached`]
+	assert.NoError(t, cached.addIns(nil, rowsChange{op: isql.Insert}, [][]interface{}{{1, `a`}}))
+	v.tables[`testingcached`] = cached
+
+	//spilled segments clear stage in transaction, cached rows are staged after them
+	assert.Equal(t, []string{`testingcached`}, v.getStageTables([]string{`testingspilled`, `testingcached`}))
+	assert.False(t, v.tables[`testingspilled`].preStaged)
+	assert.True(t, v.tables[`testingcached`].preStaged)
+}
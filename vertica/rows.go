@@ -3,11 +3,20 @@ package vertica
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/b13f/repligator/isql"
 )
 
-func (vc *Cache) tIns(schema, table string, rows [][]interface{}) (err error) {
+//replication info of rows change
+type rowsChange struct {
+	source string
+	gtid   string
+	op     string
+	ts     string
+}
+
+func (vc *Cache) tIns(change rowsChange, schema, table string, rows [][]interface{}) (err error) {
 	vc.Lock()
 	defer vc.Unlock()
 	vTableCache, ok := vc.tables[schema+table]
@@ -19,12 +28,15 @@ func (vc *Cache) tIns(schema, table string, rows [][]interface{}) (err error) {
 		vTableCache = vc.tables[schema+table]
 	}
 
-	err = vTableCache.addIns(rows)
+	err = vTableCache.addIns(vc.getExtraValues(change), change, rows)
+	vTableCache.addHeartbeat(change.source, vc.hbSchemas[change.source], rows)
+
+	vc.tables[schema+table] = vTableCache
 
 	return
 }
 
-func (vc *Cache) tDel(schema, table string, rows [][]interface{}) (err error) {
+func (vc *Cache) tDel(change rowsChange, schema, table string, rows [][]interface{}) (err error) {
 	vc.Lock()
 	defer vc.Unlock()
 	vTableCache, ok := vc.tables[schema+table]
@@ -36,7 +48,7 @@ func (vc *Cache) tDel(schema, table string, rows [][]interface{}) (err error) {
 		vTableCache = vc.tables[schema+table]
 	}
 
-	vTableCache.addDel(rows)
+	vTableCache.addDel(vc.getExtraValues(change), change, rows)
 
 	vc.tables[schema+table] = vTableCache
 
@@ -44,12 +56,33 @@ func (vc *Cache) tDel(schema, table string, rows [][]interface{}) (err error) {
 }
 
 func (vc *Cache) setRows(events isql.RowsEvent) (err error) {
+	change := rowsChange{
+		source: events.GetSourceName(),
+		gtid:   events.GetGtid(),
+		ts:     formatTime(time.Now()),
+	}
+
+	if events.GetTimestamp() > 0 {
+		change.ts = formatTime(time.Unix(int64(events.GetTimestamp()), 0))
+	}
+
+	vc.Lock()
+	vc.eventSeq++
+	vc.Unlock()
+
 	//for statement in transactions
 	for _, e := range events.GetTables() {
+		//already written by own table flush before restart
+		if vc.isTableApplied(change.source, e.GetTable().GetSchema(), e.GetTable().GetName(), change.gtid) {
+			continue
+		}
+
 		//for rows events in one query
 		for _, rows := range e.GetRows() {
 			var delRows, insRows [][]interface{}
 
+			change.op = rows.GetType()
+
 			switch rows.GetType() {
 			case isql.Insert:
 				insRows = append(insRows, rows.GetValues()...)
@@ -65,11 +98,23 @@ func (vc *Cache) setRows(events isql.RowsEvent) (err error) {
 				}
 			}
 
-			if err = vc.tDel(e.GetTable().GetSchema(), e.GetTable().GetName(), delRows); err != nil {
+			if err = vc.tDel(change, e.GetTable().GetSchema(), e.GetTable().GetName(), delRows); err != nil {
 				return
 			}
 
-			if err = vc.tIns(e.GetTable().GetSchema(), e.GetTable().GetName(), insRows); err != nil {
+			if err = vc.tIns(change, e.GetTable().GetSchema(), e.GetTable().GetName(), insRows); err != nil {
+				return
+			}
+
+			changed := len(insRows)
+			if len(delRows) > changed {
+				changed = len(delRows)
+			}
+
+			vc.markPending(e.GetTable().GetSchema(), e.GetTable().GetName(), changed)
+			rowsApplied.WithLabelValues(e.GetTable().GetSchema()+`.`+e.GetTable().GetName(), rows.GetType()).Add(float64(changed))
+
+			if err = vc.checkMemory(); err != nil {
 				return
 			}
 		}
@@ -79,8 +124,12 @@ func (vc *Cache) setRows(events isql.RowsEvent) (err error) {
 	t := vc.gtidSet
 	t[events.GetSourceName()] = events.GetGtidSet()
 	vc.gtidSet = t
+	vc.setEventTime(events.GetSourceName(), events.GetTimestamp())
+	vc.setCacheMetrics()
 	vc.Unlock()
 
+	transactionsApplied.WithLabelValues(events.GetSourceName()).Inc()
+
 	return
 }
 
@@ -96,6 +145,8 @@ func generateRow(values []interface{}) string {
 			rowValues = append(rowValues, fmt.Sprint(val))
 		case float32, float64:
 			rowValues = append(rowValues, fmt.Sprint(val))
+		case bool:
+			rowValues = append(rowValues, fmt.Sprint(val))
 			//tinyTEXT
 		case []uint8:
 			rowValues = append(rowValues, `'`+strings.Replace(bytesToString(val), `'`, `''`, -1)+`'`)
@@ -123,6 +174,8 @@ func generateRowCopy(values []interface{}) string {
 			rowValues = append(rowValues, fmt.Sprintf(`"%d"`, val))
 		case float32, float64:
 			rowValues = append(rowValues, fmt.Sprintf(`"%f"`, val))
+		case bool:
+			rowValues = append(rowValues, fmt.Sprintf(`"%t"`, val))
 			//tinyTEXT
 		case []uint8:
 			t := bytesToString(val)
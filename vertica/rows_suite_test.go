@@ -5,6 +5,7 @@ import (
 	"flag"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
@@ -175,10 +176,9 @@ func (s *RowsTestSuite) SetupSuite() {
 		isql.RowsEvent{SourceName: "test", GtidSet: "97570b38-30b9-11e7-a0a1-0242ac110001:1-58", TablesRows: []isql.TableRowsEvent{isql.TableRowsEvent{Table: isql.Table{Schema: "testing23", Name: "test4"}, Query: "", Rows: []isql.Rows{isql.Rows{Type: "update", Values: [][]interface{}{[]interface{}{1, 2, "1111"}, []interface{}{1, 2, "!!!!"}, []interface{}{2, 3, "4444"}, []interface{}{2, 3, "!!!!"}, []interface{}{3, 4, "3333"}, []interface{}{3, 4, "!!!!"}, []interface{}{4, 5, "7777"}, []interface{}{4, 5, "!!!!"}}}}}}},
 	}
 
-	skip := make(chan string)
 	sender := make(chan interface{})
 
-	_ = s.v.ApplyEvent(sender, skip)
+	_ = s.v.ApplyEvent(sender)
 	for _, ev := range s.ev[:9] {
 		sender <- ev
 	}
@@ -194,7 +194,7 @@ func (s *RowsTestSuite) SetupSuite() {
 	s.v.flushCount = 6
 	s.v.flushTime = 2
 
-	_ = s.v.ApplyEvent(sender, skip)
+	_ = s.v.ApplyEvent(sender)
 	for _, ev := range s.ev[9:31] {
 		sender <- ev
 	}
@@ -206,7 +206,7 @@ func (s *RowsTestSuite) SetupSuite() {
 
 	s.v.flushCount = 1
 
-	_ = s.v.ApplyEvent(sender, skip)
+	_ = s.v.ApplyEvent(sender)
 	for _, ev := range s.ev[31:] {
 		sender <- ev
 	}
@@ -218,7 +218,7 @@ func (s *RowsTestSuite) TestRows() {
 	var db *sql.DB
 	var err error
 
-	if db, err = sql.Open("odbc", s.v.ODBCdsn); err != nil {
+	if db, err = sql.Open(s.v.getDriver()); err != nil {
 		s.FailNow(err.Error())
 	}
 
@@ -250,10 +250,9 @@ func (s *RowsTestSuite) TestFailRows() {
 		isql.RowsEvent{SourceName: "test", GtidSet: "97570b38-30b9-11e7-a0a1-0242ac112222:1-132", TablesRows: []isql.TableRowsEvent{isql.TableRowsEvent{Table: isql.Table{Schema: "testing23", Name: "test4"}, Query: "", Rows: []isql.Rows{isql.Rows{Type: "insert", Values: [][]interface{}{[]interface{}{1, 2, "1111"}, []interface{}{2, 3, "4444"}, []interface{}{3, 4, "3333"}, []interface{}{4, 5, "7777"}}}}}}},
 	}
 
-	skip := make(chan string)
 	sender := make(chan interface{})
 
-	err := s.v.ApplyEvent(sender, skip)
+	err := s.v.ApplyEvent(sender)
 
 	for _, ev := range s.ev {
 		sender <- ev
@@ -263,6 +262,9 @@ func (s *RowsTestSuite) TestFailRows() {
 
 	s.Equal(true, strings.Contains(error.Error(), `Duplicate key values`))
 
+	//final flush of failed cache
+	s.Error(<-err)
+
 	//clear failed cache rows
 	s.v.tables = make(map[string]tableCache)
 }
@@ -272,15 +274,20 @@ func (s *RowsTestSuite) TestSkipTransaction() {
 		isql.DdlEvent{SourceName: "test", GtidSet: "97570b38-30b9-11e7-a0a1-0242ac110001:1-59", Schema: "", Query: "ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL"},
 	}
 
-	skip := make(chan string)
 	sender := make(chan interface{})
 
-	_ = s.v.ApplyEvent(sender, skip)
+	_ = s.v.ApplyEvent(sender)
 	for _, ev := range s.ev {
 		sender <- ev
 	}
 
-	s.Equal("ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL", <-skip)
+	for len(s.v.GetPendingDDL()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s.Equal("ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL", s.v.GetPendingDDL()[0].Query)
+	_, err := s.v.ResolveDDL("97570b38-30b9-11e7-a0a1-0242ac110001:1-59", DDLSkip, nil)
+	s.NoError(err)
 	sender <- true
 }
 
@@ -289,19 +296,18 @@ func (s *RowsTestSuite) TestBotInterfaces() {
 		isql.DdlEvent{SourceName: "test", GtidSet: "97570b38-30b9-11e7-a0a1-0242ac110001:1-59", Schema: "", Query: "ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL"},
 	}
 
-	skip := make(chan string)
 	sender := make(chan interface{})
 
-	_ = s.v.ApplyEvent(sender, skip)
+	_ = s.v.ApplyEvent(sender)
 	for _, ev := range s.ev {
 		sender <- ev
 	}
 
-	botCmds := s.v.GetBotInterfaces(skip)
+	botCmds := s.v.GetBotInterfaces()
 
 	s.Equal(`vsql done`, botCmds[`vsql`](`vsql CREATE SCHEMA IF NOT EXISTS "test_bot"`))
-	s.Equal("Transaction: ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL skipped",
-		botCmds[`skip`](`skip`))
+	s.Equal(`DDL 97570b38-30b9-11e7-a0a1-0242ac110001:1-59 skip done`,
+		botCmds[`skip`](`skip 97570b38-30b9-11e7-a0a1-0242ac110001:1-59`))
 
 	sender <- true
 }
@@ -311,22 +317,20 @@ func (s *RowsTestSuite) TestHttpInterfaces() {
 		isql.DdlEvent{SourceName: "test", GtidSet: "97570b38-30b9-11e7-a0a1-0242ac110001:1-60", Schema: "", Query: "ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL"},
 	}
 
-	skip := make(chan string)
 	sender := make(chan interface{})
 
-	_ = s.v.ApplyEvent(sender, skip)
+	_ = s.v.ApplyEvent(sender)
 	for _, ev := range s.ev {
 		sender <- ev
 	}
 
-	handlers := s.v.GetHTTPInterfaces(skip)
+	handlers := s.v.GetHTTPInterfaces()
 
 	w := httptest.NewRecorder()
-	handlers[`/skip`](w, httptest.NewRequest(`GET`, `/skip`, nil))
+	handlers[`/skip`](w, httptest.NewRequest(`GET`, `/skip?gtid=97570b38-30b9-11e7-a0a1-0242ac110001:1-60`, nil))
 	w.Result()
 
-	s.Equal("Transaction: ALTER TABLE testing23.test3 MODIFY COLUMN `datetime`DATETIME DEFAULT NULL skipped",
-		w.Body.String())
+	s.Equal(`DDL 97570b38-30b9-11e7-a0a1-0242ac110001:1-60 skip done`, w.Body.String())
 
 	sender <- true
 }
@@ -0,0 +1,167 @@
+package vertica
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//soft delete columns
+const (
+	deletedColumn       = "_deleted"
+	deletedAtColumn     = "_deleted_at"
+	deletedColumnType   = "BOOLEAN DEFAULT false"
+	deletedAtColumnType = "TIMESTAMPTZ"
+)
+
+//timestamps written to TIMESTAMPTZ columns with zone offset
+const timeFormat = "2006-01-02 15:04:05-07:00"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+//deleted at binlog time of delete, not at flush time
+var softDelTmpl = `UPDATE "%s"."%s" SET "` + deletedColumn + `"=true,"` + deletedAtColumn + `"='%s' WHERE %s`
+
+//row deleted before batch to mark deleted
+type softDel struct {
+	cond string //key values or full row condition
+	ts   string //binlog time of delete
+}
+
+var tablesSQL = `SELECT table_schema,table_name FROM v_catalog.tables WHERE NOT is_temp_table`
+
+var enabledConstraintsSQLTmpl = `SELECT c.constraint_name FROM v_catalog.table_constraints c JOIN v_catalog.tables t ON c.table_id=t.table_id WHERE t.table_schema='%s' AND t.table_name='%s' AND c.constraint_type IN ('p','u') AND c.is_enabled`
+
+//positions and DDL history of repligator itself
+func isSystemTable(schema, table string) bool {
+	return schema == "public" && strings.HasPrefix(table, "__repligator_")
+}
+
+//add soft delete columns to existed tables and disable their keys
+func (vc *Cache) migrateSoftDelete() (err error) {
+	var softDelete bool
+
+	for _, tc := range vc.tablesConf {
+		softDelete = softDelete || tc.SoftDelete
+	}
+
+	if !softDelete {
+		return
+	}
+
+	rows, err := vc.db.Query(tablesSQL)
+	if err != nil {
+		return
+	}
+
+	var schema, table string
+	var tables [][2]string
+
+	for rows.Next() {
+		if err = rows.Scan(&schema, &table); err != nil {
+			rows.Close()
+			return
+		}
+
+		if vc.getTableConfig(schema, table).SoftDelete && !vc.isHistoryTable(schema, table) && !isStageTable(table) && !isSystemTable(schema, table) {
+			tables = append(tables, [2]string{schema, table})
+		}
+	}
+
+	rows.Close()
+
+	for _, t := range tables {
+		var vsqls []string
+
+		if vsqls, err = vc.getSoftDeleteMigrationSQL(t[0], t[1]); err != nil {
+			return
+		}
+
+		if len(vsqls) == 0 {
+			continue
+		}
+
+		log.Infof("Soft delete migration of %s.%s: %v", t[0], t[1], vsqls)
+
+		if _, err = vc.Exec(vsqls); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (vc *Cache) getSoftDeleteMigrationSQL(schema, table string) (vsqls []string, err error) {
+	tableInfo, err := vc.newVerticaTableCache(schema, table)
+	if err != nil {
+		return
+	}
+
+	alter := fmt.Sprintf(`ALTER TABLE "%s"."%s" `, schema, table)
+
+	if !tableInfo.hasColumn(deletedColumn) {
+		vsqls = append(vsqls, alter+fmt.Sprintf(`ADD COLUMN "%s" %s`, deletedColumn, deletedColumnType))
+	}
+
+	if !tableInfo.hasColumn(deletedAtColumn) {
+		vsqls = append(vsqls, alter+fmt.Sprintf(`ADD COLUMN "%s" %s`, deletedAtColumn, deletedAtColumnType))
+	}
+
+	rows, err := vc.db.Query(fmt.Sprintf(enabledConstraintsSQLTmpl, schema, table))
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	var name string
+
+	for rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+
+		vsqls = append(vsqls, alter+fmt.Sprintf(`ALTER CONSTRAINT "%s" DISABLED`, name))
+	}
+
+	return
+}
+
+//return mark deleted statements, keys deleted at same time in one statement
+func (t *tableCache) getSoftDelSQL(pack int) (vsqls []string) {
+	if len(t.leadConstrColNames) == 0 {
+		for _, del := range t.tSoftDels {
+			vsqls = append(vsqls, fmt.Sprintf(softDelTmpl, t.schema, t.name, del.ts, del.cond))
+		}
+		return
+	}
+
+	var times []string
+	keys := make(map[string][]string)
+
+	for _, del := range t.tSoftDels {
+		if _, ok := keys[del.ts]; !ok {
+			times = append(times, del.ts)
+		}
+		keys[del.ts] = append(keys[del.ts], del.cond)
+	}
+
+	for _, ts := range times {
+		for start := 0; start < len(keys[ts]); start += pack {
+			end := start + pack
+			if end > len(keys[ts]) {
+				end = len(keys[ts])
+			}
+
+			cond := t.keyColumnsSQL() + ` IN (` + strings.Join(keys[ts][start:end], ",") + `) AND "` + deletedColumn + `"=false`
+
+			vsqls = append(vsqls, fmt.Sprintf(softDelTmpl, t.schema, t.name, ts, cond))
+		}
+	}
+
+	return
+}
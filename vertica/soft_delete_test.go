@@ -0,0 +1,50 @@
+package vertica
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftDeleteCache(t *testing.T) {
+	table := newKeyTable(`soft`, `id`, `val`, deletedColumn, deletedAtColumn)
+	table.extraColumns = []extraColumn{{name: deletedColumn, pos: 2}, {name: deletedAtColumn, pos: 3}}
+	table.softDelete = true
+
+	change := rowsChange{source: `test`, op: isql.Delete, ts: `2017-01-01 00:00:01+00:00`}
+	extra := New(Config{}).getExtraValues(change)
+
+	assert.NoError(t, table.addIns(extra, rowsChange{source: `test`, op: isql.Insert}, [][]interface{}{{1, `a`}, {2, `b`}}))
+	table.addDel(extra, change, [][]interface{}{{2, `b`}, {3, `c`}})
+	table.addDel(extra, rowsChange{source: `test`, op: isql.Update}, [][]interface{}{{4, `d`}})
+
+	assert.Equal(t, 2, len(table.tIns))
+	assert.Equal(t, []softDel{{cond: `3`, ts: change.ts}}, table.tSoftDels)
+	assert.Equal(t, []string{`4`}, table.tDels)
+	assert.Equal(t, []string{`DELETE FROM "testing"."soft" WHERE "id" IN (4) AND "_deleted"=false`}, table.getDelSQL(10))
+
+	//row existed in Vertica and row of batch get same binlog time of delete
+	for _, val := range table.tIns {
+		if strings.HasPrefix(val, `"2"`) {
+			assert.Equal(t, `"2","b","true","2017-01-01 00:00:01+00:00"`, val)
+		}
+	}
+
+	table.addDel(extra, rowsChange{source: `test`, op: isql.Delete, ts: `2017-01-01 00:00:02+00:00`}, [][]interface{}{{5, `e`}})
+	assert.Equal(t, []string{
+		`UPDATE "testing"."soft" SET "_deleted"=true,"_deleted_at"='2017-01-01 00:00:01+00:00' WHERE "id" IN (3) AND "_deleted"=false`,
+		`UPDATE "testing"."soft" SET "_deleted"=true,"_deleted_at"='2017-01-01 00:00:02+00:00' WHERE "id" IN (5) AND "_deleted"=false`,
+	}, table.getSoftDelSQL(10))
+}
+
+func TestSoftDeleteSystemTable(t *testing.T) {
+	assert.True(t, isSystemTable(`public`, `__repligator_ddl`))
+	assert.False(t, isSystemTable(`app`, `__repligator_ddl`))
+}
+
+func TestFormatTime(t *testing.T) {
+	assert.Equal(t, `1970-01-01 00:00:00+00:00`, formatTime(time.Unix(0, 0)))
+}
@@ -0,0 +1,360 @@
+package vertica
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//pending rows of table written to data dir before flush, applied in spill order
+type spillSegment struct {
+	insFile     string
+	ins         int
+	delsFile    string
+	dels        int
+	softFile    string
+	soft        int
+	historyFile string
+	history     int
+	closesFile  string
+	closes      int
+}
+
+//approximate size of cached values
+func (t *tableCache) setIns(key, val string) {
+	if old, ok := t.tIns[key]; ok {
+		t.memory -= len(key) + len(old)
+	}
+
+	t.tIns[key] = val
+	t.memory += len(key) + len(val)
+}
+
+func (t *tableCache) delIns(key string) {
+	if old, ok := t.tIns[key]; ok {
+		t.memory -= len(key) + len(old)
+		delete(t.tIns, key)
+	}
+}
+
+func (t *tableCache) setMergeDel(key, val string) {
+	if old, ok := t.mDels[key]; ok {
+		t.memory -= len(key) + len(old)
+	}
+
+	t.mDels[key] = val
+	t.memory += len(key) + len(val)
+}
+
+func (t *tableCache) delMergeDel(key string) {
+	if old, ok := t.mDels[key]; ok {
+		t.memory -= len(key) + len(old)
+		delete(t.mDels, key)
+	}
+}
+
+//return approximate size of cached values and row versions of table
+func (t *tableCache) getMemory() int {
+	if t.history == nil {
+		return t.memory
+	}
+
+	return t.memory + t.history.memory
+}
+
+//return approximate size of all cached tables
+func (vc *Cache) cacheMemory() (memory int) {
+	for _, table := range vc.tables {
+		memory += table.getMemory()
+	}
+
+	return
+}
+
+//return approximate size of row values
+func rowMemory(row []interface{}) (memory int) {
+	for _, val := range row {
+		switch v := val.(type) {
+		case string:
+			memory += len(v)
+		case []byte:
+			memory += len(v)
+		default:
+			memory += 8
+		}
+	}
+
+	return
+}
+
+//remove spill files left by crash, their changes are replayed from position
+func (vc *Cache) removeSpills() (err error) {
+	files, err := filepath.Glob(vc.dataDir + `spill-*`)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		log.Infof("Remove spill file %s", file)
+		if err = os.Remove(file); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//spill tables to disk when cache is over memory limit, flush needed after it
+func (vc *Cache) checkMemory() (err error) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	if vc.memoryLimit == 0 || vc.cacheMemory() <= vc.memoryLimit {
+		return
+	}
+
+	log.Infof("Cache memory %d over limit %d, spill to %s", vc.cacheMemory(), vc.memoryLimit, vc.dataDir)
+
+	for i, table := range vc.tables {
+		if err = table.spill(vc.dataDir, table.getPack(vc)); err != nil {
+			return
+		}
+
+		vc.tables[i] = table
+	}
+
+	vc.spilled = true
+
+	return
+}
+
+//write pending inserts, deletes and row versions to files and clear them
+func (t *tableCache) spill(dataDir string, pack int) (err error) {
+	if len(t.tIns) == 0 && len(t.tDels) == 0 && len(t.tSoftDels) == 0 && len(t.mDels) == 0 && t.history.len() == 0 && !t.history.hasCloses() {
+		return
+	}
+
+	prefix := fmt.Sprintf(`%sspill-%s-%s-%d`, dataDir, t.schema, t.name, len(t.spills))
+	segment := spillSegment{insFile: prefix + `.ins`, delsFile: prefix + `.dels`, softFile: prefix + `.soft`,
+		historyFile: prefix + `.history`, closesFile: prefix + `.closes`}
+
+	ins := make([]string, 0, len(t.tIns))
+	for _, val := range t.tIns {
+		ins = append(ins, val)
+	}
+
+	if err = writeCopyFile(segment.insFile, ins); err != nil {
+		return
+	}
+
+	//merge deletes are loaded into stage
+	if t.merge {
+		dels := make([]string, 0, len(t.mDels))
+		for _, val := range t.mDels {
+			dels = append(dels, val)
+		}
+
+		segment.dels = len(dels)
+		err = writeCopyFile(segment.delsFile, dels)
+	} else {
+		segment.dels = len(t.tDels)
+		err = writeLines(segment.delsFile, t.tDels)
+	}
+
+	if err != nil {
+		return
+	}
+
+	//soft deletes keep time of delete in statements
+	soft := t.getSoftDelSQL(pack)
+
+	if err = writeLines(segment.softFile, soft); err != nil {
+		return
+	}
+
+	if t.history != nil {
+		//versions closed before new ones of segment are written
+		closes := t.getHistoryCloseSQL(pack)
+		history := t.getHistoryLines()
+
+		if err = writeLines(segment.closesFile, closes); err != nil {
+			return
+		}
+
+		if err = writeCopyFile(segment.historyFile, history); err != nil {
+			return
+		}
+
+		segment.closes = len(closes)
+		segment.history = len(history)
+		t.history = newHistoryCache()
+	}
+
+	segment.ins = len(ins)
+	segment.soft = len(soft)
+
+	t.spills = append(t.spills, segment)
+
+	t.tIns = make(map[string]string)
+	t.tDels = make([]string, 0)
+	t.tDelKeys = make(map[string]string)
+	t.tSoftDels = make([]softDel, 0)
+	if t.merge {
+		t.mDels = make(map[string]string)
+	}
+	t.memory = 0
+
+	return
+}
+
+//write quoted lines, values may have line breaks
+func writeLines(filename string, lines []string) (err error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	for _, line := range lines {
+		if _, err = w.WriteString(strconv.Quote(line) + "\n"); err != nil {
+			return
+		}
+	}
+
+	return w.Flush()
+}
+
+func readLines(filename string) (lines []string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024*1024)
+
+	var line string
+	for scanner.Scan() {
+		if line, err = strconv.Unquote(scanner.Text()); err != nil {
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+//apply spilled segments before cached rows
+func (t *tableCache) tableSpillsExec(vert *Cache) (err error) {
+	for _, segment := range t.spills {
+		log.Debugf("Start spill %s: %d ins, %d dels, %d soft dels", segment.insFile, segment.ins, segment.dels, segment.soft)
+
+		if t.merge {
+			err = t.segmentMergeExec(vert, segment)
+		} else {
+			err = t.segmentExec(vert, segment)
+		}
+
+		if err != nil {
+			return
+		}
+
+		if err = t.segmentHistoryExec(vert, segment); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//remove spill files of table after its flush committed
+func (t *tableCache) removeSpillFiles() {
+	for _, segment := range t.spills {
+		for _, file := range []string{segment.insFile, segment.delsFile, segment.softFile, segment.historyFile, segment.closesFile} {
+			os.Remove(file)
+		}
+	}
+
+	t.spills = nil
+}
+
+func (t *tableCache) segmentExec(vert *Cache, segment spillSegment) (err error) {
+	var lines []string
+
+	if segment.dels > 0 {
+		if lines, err = readLines(segment.delsFile); err != nil {
+			return
+		}
+
+		if _, err = vert.Exec(t.getKeysDelSQL(lines, t.getPack(vert))); err != nil {
+			return
+		}
+	}
+
+	if segment.soft > 0 {
+		if lines, err = readLines(segment.softFile); err != nil {
+			return
+		}
+
+		if _, err = vert.Exec(lines); err != nil {
+			return
+		}
+	}
+
+	if segment.ins > 0 {
+		err = vert.copyFile(t.schema, t.name, nil, segment.insFile)
+	}
+
+	return
+}
+
+func (t *tableCache) segmentHistoryExec(vert *Cache, segment spillSegment) (err error) {
+	var lines []string
+
+	if segment.closes > 0 {
+		if lines, err = readLines(segment.closesFile); err != nil {
+			return
+		}
+
+		if _, err = vert.Exec(lines); err != nil {
+			return
+		}
+	}
+
+	if segment.history > 0 {
+		err = vert.copyFile(t.schema, t.name+historySuffix, t.historyColumns(), segment.historyFile)
+	}
+
+	return
+}
+
+func (t *tableCache) segmentMergeExec(vert *Cache, segment spillSegment) (err error) {
+	if _, err = vert.Exec(t.getStageClearSQL()); err != nil {
+		return
+	}
+
+	if segment.dels > 0 {
+		if err = vert.copyFile(t.schema, t.name+stageDelSuffix, nil, segment.delsFile); err != nil {
+			return
+		}
+	}
+
+	if segment.ins > 0 {
+		if err = vert.copyFile(t.schema, t.name+stageSuffix, nil, segment.insFile); err != nil {
+			return
+		}
+	}
+
+	_, err = vert.Exec(t.getMergeSQL(segment.dels > 0, segment.ins > 0))
+
+	return
+}
@@ -0,0 +1,109 @@
+package vertica
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+//temporary data dir with trailing separator as in config
+func newSpillDir(t *testing.T) (string, bool) {
+	dataDir, err := ioutil.TempDir(``, `spill`)
+	if !assert.NoError(t, err) {
+		return ``, false
+	}
+
+	return dataDir + string(os.PathSeparator), true
+}
+
+func TestSpillCache(t *testing.T) {
+	table := newKeyTable(`spill`, `id`, `val`)
+
+	upd := rowsChange{op: isql.Update}
+
+	table.addDel(nil, upd, [][]interface{}{{1, `a`}})
+	assert.NoError(t, table.addIns(nil, upd, [][]interface{}{{1, "b\nc"}}))
+	assert.Equal(t, len(`"1"`)+len(`1`)+len(`1`)+len("\"1\",\"b\nc\""), table.memory)
+
+	dataDir, ok := newSpillDir(t)
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dataDir)
+
+	assert.NoError(t, table.spill(dataDir, 100))
+
+	assert.Equal(t, 0, table.memory)
+	assert.Empty(t, table.tIns)
+	assert.Empty(t, table.tDels)
+	assert.Equal(t, 1, len(table.spills))
+
+	dels, err := readLines(table.spills[0].delsFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`1`}, dels)
+
+	ins, err := ioutil.ReadFile(table.spills[0].insFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"1\",\"b\nc\"\t\r\n", string(ins))
+
+	//files removed after flush committed
+	spilled := table.spills[0]
+	table.removeSpillFiles()
+	assert.Empty(t, table.spills)
+	_, err = os.Stat(spilled.insFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSpillHistory(t *testing.T) {
+	table := newKeyTable(`spill_history`, `id`, `val`)
+	table.history = newHistoryCache()
+
+	upd := rowsChange{op: isql.Update, ts: `2017-01-01 00:00:01+00:00`, gtid: `uuid:2`}
+
+	table.addDel(nil, upd, [][]interface{}{{1, `a`}})
+	assert.NoError(t, table.addIns(nil, upd, [][]interface{}{{1, `b`}}))
+	assert.True(t, table.getMemory() > table.memory)
+
+	dataDir, ok := newSpillDir(t)
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dataDir)
+
+	assert.NoError(t, table.spill(dataDir, 100))
+	assert.Equal(t, 0, table.getMemory())
+	assert.Equal(t, 0, table.history.len())
+
+	closes, err := readLines(table.spills[0].closesFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`UPDATE "testing"."spill_history_history" SET "_valid_to"='2017-01-01 00:00:01+00:00' WHERE "id" IN (1) AND "_valid_to" IS NULL`}, closes)
+
+	history, err := ioutil.ReadFile(table.spills[0].historyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"1\",\"b\",\"2017-01-01 00:00:01+00:00\",NULL,\"update\",\"uuid:2\"\t\r\n", string(history))
+}
+
+func TestRemoveStaleSpills(t *testing.T) {
+	dataDir, ok := newSpillDir(t)
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dataDir)
+
+	stale := dataDir + `spill-testing-stale-0.ins`
+	other := dataDir + `other.ins`
+	for _, file := range []string{stale, other} {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(`"1"`), 0600))
+	}
+
+	//files left by crash, their changes are replayed from position
+	assert.NoError(t, New(Config{DataDir: dataDir}).removeSpills())
+
+	_, err := os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,128 @@
+package vertica
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//Status is destination state for status API
+type Status struct {
+	Gtid      map[string]string    `json:"gtid"`
+	Committed map[string]time.Time `json:"committed"` //binlog time of last written position
+	Lag       map[string]float64   `json:"lag"`       //seconds
+	Heartbeat map[string]float64   `json:"heartbeat"` //seconds from heartbeat write to commit
+	Memory    int                  `json:"memory"`
+	Tables    []TableStatus        `json:"tables"`
+	LastFlush *FlushResult         `json:"last_flush"`
+}
+
+//TableStatus is cached changes of table
+type TableStatus struct {
+	Name         string `json:"name"`
+	Inserts      int    `json:"inserts"`
+	Deletes      int    `json:"deletes"`
+	SoftDeletes  int    `json:"soft_deletes"`
+	MergeDeletes int    `json:"merge_deletes"`
+	History      int    `json:"history"`
+	Spills       int    `json:"spills"`
+	Rows         int    `json:"rows"`
+}
+
+//FlushResult is result of last cache flush
+type FlushResult struct {
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration"` //seconds
+	Tables   int       `json:"tables"`
+	Error    string    `json:"error,omitempty"`
+}
+
+//state readable while cache locked by flush
+type statusState struct {
+	sync.Mutex
+	flushing   *Status
+	flushStart time.Time //start of running flush
+	lastFlush  *FlushResult
+	loopAt     time.Time //last apply loop iteration
+	waitDDL    bool      //apply loop waits action on pending DDL
+}
+
+//GetStatus return current state of cache, state before flush while flushing
+func (vc *Cache) GetStatus() Status {
+	vc.status.Lock()
+	if vc.status.flushing != nil {
+		status := *vc.status.flushing
+		status.LastFlush = vc.status.lastFlush
+		vc.status.Unlock()
+		return status
+	}
+	vc.status.Unlock()
+
+	vc.Lock()
+	status := vc.getStatus()
+	vc.Unlock()
+
+	vc.status.Lock()
+	status.LastFlush = vc.status.lastFlush
+	vc.status.Unlock()
+
+	return status
+}
+
+func (vc *Cache) getStatus() Status {
+	status := Status{Gtid: make(map[string]string), Committed: make(map[string]time.Time), Lag: vc.getLag(time.Now()), Heartbeat: make(map[string]float64), Memory: vc.cacheMemory(), Tables: []TableStatus{}}
+
+	for name, set := range vc.gtidSet {
+		status.Gtid[name] = set
+	}
+
+	for name, ts := range vc.committed {
+		status.Committed[name] = ts
+	}
+
+	for name, lag := range vc.heartbeatLag {
+		status.Heartbeat[name] = lag
+	}
+
+	for _, table := range vc.tables {
+		status.Tables = append(status.Tables, TableStatus{
+			Name:         table.schema + `.` + table.name,
+			Inserts:      len(table.tIns),
+			Deletes:      len(table.tDels),
+			SoftDeletes:  len(table.tSoftDels),
+			MergeDeletes: len(table.mDels),
+			History:      table.history.len(),
+			Spills:       len(table.spills),
+			Rows:         table.rows,
+		})
+	}
+
+	sort.Slice(status.Tables, func(i, j int) bool { return status.Tables[i].Name < status.Tables[j].Name })
+
+	return status
+}
+
+//remember state before flush
+func (vc *Cache) startFlushStatus(start time.Time) {
+	vc.Lock()
+	status := vc.getStatus()
+	vc.Unlock()
+
+	vc.status.Lock()
+	vc.status.flushing = &status
+	vc.status.flushStart = start
+	vc.status.Unlock()
+}
+
+//save flush result
+func (vc *Cache) endFlushStatus(start time.Time, tables int, err error) {
+	result := &FlushResult{Time: start, Duration: time.Since(start).Seconds(), Tables: tables}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	vc.status.Lock()
+	vc.status.flushing = nil
+	vc.status.lastFlush = result
+	vc.status.Unlock()
+}
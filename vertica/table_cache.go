@@ -3,11 +3,15 @@ package vertica
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+
+	"github.com/b13f/repligator/isql"
 )
 
 type constraint struct {
@@ -15,6 +19,15 @@ type constraint struct {
 	columnsPositionMap map[string]int
 }
 
+func (c constraint) hasColumn(name string) bool {
+	for column := range c.columnsPositionMap {
+		if strings.EqualFold(column, name) {
+			return true
+		}
+	}
+	return false
+}
+
 type tableCache struct {
 	schema             string
 	name               string
@@ -22,15 +35,43 @@ type tableCache struct {
 	enums              []enum
 	constraints        []constraint
 	leadConstrColOrder []int
-	leadConstrColNames map[string]int    //main constraint to operate
-	tDels              []string          //values to del query
-	tIns               map[string]string //values to csv copy query
+	leadConstrColNames map[string]int       //main constraint to operate
+	extraColumns       []extraColumn        //columns added by repligator in position order
+	metaColumns        []int                //positions of change metadata columns
+	softDelete         bool                 //mark deleted rows instead of delete
+	tDels              []string             //values to del query
+	tDelKeys           map[string]string    //keys already in del query to csv copy of key values
+	tSoftDels          []softDel            //rows to mark deleted query
+	tIns               map[string]string    //values to csv copy query
+	history            *historyCache        //rows versions, nil if history disabled
+	merge              bool                 //flush by merge from staging tables
+	staged             bool                 //staging tables exist
+	preStaged          bool                 //batch loaded into stage by parallel flush
+	mDels              map[string]string    //deleted keys to merge stage
+	memory             int                  //approximate size of cached values
+	spills             []spillSegment       //cached values written to disk
+	flushCount         int                  //own flush policy rows, 0 is global policy
+	flushTime          int                  //own flush policy seconds, 0 is global policy
+	pack               int                  //own delete pack size, 0 is global
+	rows               int                  //changed rows cached since flush
+	pendingFrom        map[string]string    //source position before first cached change, nil if nothing cached
+	pendingTimes       map[string]time.Time //source event times before first cached change
+	pendingSince       time.Time            //time of first cached change
+	pendingSeq         int                  //transaction number of first cached change
+	heartbeats         map[string]int64     //source to latest cached heartbeat in milliseconds
+}
+
+//column not existed in source table
+type extraColumn struct {
+	name string
+	pos  int
 }
 
 var tableConstraintsSQLTmpl = `SELECT constraint_id,column_name,constraint_type FROM V_CATALOG.constraint_columns WHERE table_schema='%s' AND table_name='%s' AND constraint_type in ('p','u') ORDER BY constraint_id`
 
 func (vc *Cache) newVerticaTableCache(schema, table string) (t tableCache, err error) {
 	t = tableCache{schema: schema, name: table}
+	extraNames := vc.getExtraColumns(schema, table)
 
 	if t.constraints, err = vc.getTableConstraints(schema, table); err != nil {
 		return
@@ -61,6 +102,16 @@ func (vc *Cache) newVerticaTableCache(schema, table string) (t tableCache, err e
 			t.constraints[i] = constraint
 		}
 
+		for _, name := range extraNames {
+			if name == columnName {
+				t.extraColumns = append(t.extraColumns, extraColumn{name: name, pos: len(t.columnNames)})
+			}
+		}
+
+		if vc.isMetaColumn(columnName) {
+			t.metaColumns = append(t.metaColumns, len(t.columnNames))
+		}
+
 		t.columnNames = append(t.columnNames, columnName)
 	}
 
@@ -76,6 +127,18 @@ func (vc *Cache) newVerticaTableCache(schema, table string) (t tableCache, err e
 		return
 	}
 
+	t.softDelete = vc.getTableConfig(schema, table).SoftDelete && t.hasColumn(deletedColumn) && t.hasColumn(deletedAtColumn)
+
+	conf := vc.getTableConfig(schema, table)
+	t.flushCount, t.flushTime, t.pack = conf.FlushCount, conf.FlushTime, conf.Pack
+
+	if vc.getTableConfig(schema, table).History {
+		if err = vc.createHistory(schema, table); err != nil {
+			return
+		}
+		t.history = newHistoryCache()
+	}
+
 	t.leadConstrColNames = t.mainConstrInit(t.constraints)
 
 	var sortedKeys []int
@@ -89,6 +152,10 @@ func (vc *Cache) newVerticaTableCache(schema, table string) (t tableCache, err e
 
 	t.tIns = make(map[string]string)
 
+	if err = vc.initStage(&t); err != nil {
+		return
+	}
+
 	return t, nil
 }
 
@@ -132,8 +199,48 @@ func (vc *Cache) getTableConstraints(schema, table string) (constraints []constr
 }
 
 func (t *tableCache) getRowHashKey(row []interface{}) string {
+	//only last state of key kept, deleted versions of soft delete duplicate keys
+	if len(t.leadConstrColNames) > 0 && !t.softDelete && !t.hasNullKey(row) {
+		return t.generateKey(row)
+	}
+
 	//hash without collision
-	return generateRow(row)
+	return generateRow(t.withoutMeta(row))
+}
+
+//column names are case insensitive in MySQL and Vertica
+func (t *tableCache) hasColumn(name string) bool {
+	for _, columnName := range t.columnNames {
+		if strings.EqualFold(columnName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//check table already has same primary or unique key
+func (t *tableCache) hasConstraint(keyType string, columns []string) bool {
+	for _, constr := range t.constraints {
+		if keyType == isql.Primary && constr.constraintType == "p" {
+			return true
+		}
+
+		if keyType != isql.Unique || constr.constraintType != "u" || len(constr.columnsPositionMap) != len(columns) {
+			continue
+		}
+
+		same := true
+		for _, column := range columns {
+			if !constr.hasColumn(roundBrack.ReplaceAllLiteralString(column, "")) {
+				same = false
+			}
+		}
+
+		if same {
+			return true
+		}
+	}
+	return false
 }
 
 func (t *tableCache) analyzeStatisticsQuery() string {
@@ -163,12 +270,54 @@ func (t *tableCache) mainConstrInit(constraints []constraint) (key map[string]in
 	return
 }
 
-func (t *tableCache) addIns(rows [][]interface{}) (err error) {
+//insert values of extra columns at their positions
+func (t *tableCache) withExtra(row []interface{}, values map[string]interface{}) []interface{} {
+	if len(t.extraColumns) == 0 {
+		return row
+	}
+
+	full := make([]interface{}, 0, len(row)+len(t.extraColumns))
+	full = append(full, row...)
+
+	for _, col := range t.extraColumns {
+		if col.pos > len(full) {
+			break
+		}
+
+		full = append(full, nil)
+		copy(full[col.pos+1:], full[col.pos:])
+		full[col.pos] = values[col.name]
+	}
+
+	return full
+}
+
+//set values of extra column
+func (t *tableCache) setExtra(row []interface{}, name string, value interface{}) {
+	for _, col := range t.extraColumns {
+		if col.name == name && col.pos < len(row) {
+			row[col.pos] = value
+		}
+	}
+}
+
+func (t *tableCache) addIns(extra map[string]interface{}, change rowsChange, rows [][]interface{}) (err error) {
 	for _, row := range rows {
+		row = t.withExtra(row, extra)
+
 		if len(t.enums) > 0 {
 			enumToVal(t.enums, row)
 		}
 
+		if t.history != nil {
+			t.addHistory(row, change)
+		}
+
+		//merge updates deleted key
+		if t.merge {
+			t.delMergeDel(t.generateKey(row))
+		}
+
 		hash := t.getRowHashKey(row)
 
 		//check for collisions
@@ -178,54 +327,143 @@ func (t *tableCache) addIns(rows [][]interface{}) (err error) {
 			}
 		}
 
-		t.tIns[t.getRowHashKey(row)] = generateRowCopy(row)
+		t.setIns(hash, generateRowCopy(row))
 	}
 
 	return
 }
 
-func (t *tableCache) addDel(rows [][]interface{}) {
+//soft deletes only for rows deleted in source, not for updates
+func (t *tableCache) addDel(extra map[string]interface{}, change rowsChange, rows [][]interface{}) {
+	soft := change.op == isql.Delete && t.softDelete
+
 	for _, row := range rows {
+		row = t.withExtra(row, extra)
+
 		if len(t.enums) > 0 {
 			enumToVal(t.enums, row)
 		}
 
+		//updated row version is closed, new one is written by insert
+		if t.history != nil && change.op == isql.Delete {
+			t.addHistory(row, change)
+		} else if t.history != nil {
+			t.history.close(t.historyKey(row), change)
+		}
+
 		hash := t.getRowHashKey(row)
 
 		//first check in local inserts
 		if _, ok := t.tIns[hash]; ok {
-			delete(t.tIns, hash)
+			t.delIns(hash)
+
+			//keep deleted version
+			if soft {
+				t.setExtra(row, deletedColumn, true)
+				t.setExtra(row, deletedAtColumn, change.ts)
+				t.setIns(t.getRowHashKey(row), generateRowCopy(row))
+			}
+		} else if soft {
+			del := softDel{cond: t.generateSoftDel(row), ts: change.ts}
+			t.tSoftDels = append(t.tSoftDels, del)
+			t.memory += len(del.cond) + len(del.ts)
+		} else if t.merge {
+			t.addMergeDel(row)
 		} else {
-			t.tDels = append(t.tDels, t.generateDel(row))
+			t.addKeyDel(row)
 		}
 	}
 }
 
+//one delete per key existed before batch
+func (t *tableCache) addKeyDel(row []interface{}) {
+	del := t.generateDel(row)
+
+	if len(t.leadConstrColNames) > 0 {
+		if t.tDelKeys == nil {
+			t.tDelKeys = make(map[string]string)
+		}
+
+		if _, ok := t.tDelKeys[del]; ok {
+			return
+		}
+
+		//key string is shared with deletes list
+		t.tDelKeys[del] = generateRowCopy(t.keyValues(row))
+		t.memory += len(t.tDelKeys[del])
+	}
+
+	t.tDels = append(t.tDels, del)
+	t.memory += len(del)
+}
+
+//where condition by all columns
+func (t *tableCache) rowCondition(row []interface{}) string {
+	var val string
+	var columnValue []string
+
+	for i, column := range t.columnNames {
+		if t.isMetaPosition(i) {
+			continue
+		}
+
+		val = generateRow(row[i : i+1])
+		if val == "NULL" {
+			columnValue = append(columnValue, fmt.Sprintf(`"%s" IS NULL`, column))
+		} else {
+			columnValue = append(columnValue, fmt.Sprintf(`"%s"=%s`, column, val))
+		}
+	}
+
+	return strings.Join(columnValue, " AND ")
+}
+
 func (t *tableCache) generateDel(row []interface{}) string {
 	//full del
 	if len(t.leadConstrColNames) == 0 {
 		sqlDelFull := `DELETE FROM "%s"."%s" WHERE %s`
-		var val string
-		var columnValue []string
-
-		for i, column := range t.columnNames {
-			val = generateRow(row[i : i+1])
-			if val == "NULL" {
-				columnValue = append(columnValue, fmt.Sprintf(`"%s" IS NULL`, column))
-			} else {
-				columnValue = append(columnValue, fmt.Sprintf(`"%s"=%s`, column, val))
-			}
-		}
 
-		return fmt.Sprintf(sqlDelFull, t.schema, t.name, strings.Join(columnValue, " AND "))
+		return fmt.Sprintf(sqlDelFull, t.schema, t.name, t.rowCondition(row))
 	}
 
-	//del by primary or unique
+	return t.generateKey(row)
+}
+
+func (t *tableCache) generateSoftDel(row []interface{}) string {
+	//full row condition
+	if len(t.leadConstrColNames) == 0 {
+		return t.rowCondition(row)
+	}
+
+	return t.generateKey(row)
+}
+
+//unique key with NULL does not identify row
+func (t *tableCache) hasNullKey(row []interface{}) bool {
+	for _, n := range t.leadConstrColOrder {
+		if row[n] == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+//return primary or unique key values of row
+func (t *tableCache) keyValues(row []interface{}) []interface{} {
 	curr := make([]interface{}, 0)
 	for _, n := range t.leadConstrColOrder {
 		curr = append(curr, row[n])
 	}
 
+	return curr
+}
+
+//return primary or unique key of row for IN condition
+func (t *tableCache) generateKey(row []interface{}) string {
+	//del by primary or unique
+	curr := t.keyValues(row)
+
 	var valTpl string
 	if valTpl = "(%s)"; len(t.leadConstrColNames) == 1 {
 		valTpl = "%s"
@@ -235,39 +473,50 @@ func (t *tableCache) generateDel(row []interface{}) string {
 }
 
 func (t *tableCache) getDelSQL(pack int) (vsqls []string) {
+	return t.getKeysDelSQL(t.tDels, pack)
+}
+
+//return delete statements for keys or full row statements
+func (t *tableCache) getKeysDelSQL(dels []string, pack int) (vsqls []string) {
 	if len(t.leadConstrColNames) == 0 {
-		return t.tDels
+		return dels
 	}
 
 	delTpl := `DELETE FROM "%s"."%s" WHERE %s IN (%s)`
 
-	var columnNames string
-
-	keyNames := make([]string, 0)
-	for _, n := range t.leadConstrColOrder {
-		keyNames = append(keyNames, t.columnNames[n])
+	//deleted versions stay
+	if t.softDelete {
+		delTpl += fmt.Sprintf(` AND "%s"=false`, deletedColumn)
 	}
 
-	if len(t.leadConstrColNames) == 1 {
-		columnNames = `"` + keyNames[0] + `"`
-	} else {
-		columnNames = `("` + strings.Join(keyNames, `","`) + `")`
-	}
+	columnNames := t.keyColumnsSQL()
 
-	for p := 0; p < ((len(t.tDels) / pack) + 1); p++ {
-		if p < (len(t.tDels) / pack) {
-			vsqls = append(vsqls, fmt.Sprintf(delTpl, t.schema, t.name, columnNames, strings.Join(t.tDels[(p*pack):((p+1)*pack)], ",")))
+	for p := 0; p < ((len(dels) / pack) + 1); p++ {
+		if p < (len(dels) / pack) {
+			vsqls = append(vsqls, fmt.Sprintf(delTpl, t.schema, t.name, columnNames, strings.Join(dels[(p*pack):((p+1)*pack)], ",")))
 		} else {
-			vsqls = append(vsqls, fmt.Sprintf(delTpl, t.schema, t.name, columnNames, strings.Join(t.tDels[(p*pack):], ",")))
+			vsqls = append(vsqls, fmt.Sprintf(delTpl, t.schema, t.name, columnNames, strings.Join(dels[(p*pack):], ",")))
 		}
 	}
 
 	return
 }
 
-func (t *tableCache) getInsFile(dataDir string) (filename string, err error) {
-	filename = dataDir + t.schema + `-` + t.name
+//return key columns for IN condition
+func (t *tableCache) keyColumnsSQL() string {
+	keyNames := make([]string, 0)
+	for _, n := range t.leadConstrColOrder {
+		keyNames = append(keyNames, t.columnNames[n])
+	}
 
+	if len(t.leadConstrColNames) == 1 {
+		return `"` + keyNames[0] + `"`
+	}
+
+	return `("` + strings.Join(keyNames, `","`) + `")`
+}
+
+func writeCopyFile(filename string, lines []string) (err error) {
 	os.Remove(filename)
 
 	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -275,11 +524,17 @@ func (t *tableCache) getInsFile(dataDir string) (filename string, err error) {
 		return
 	}
 
-	for _, val := range t.tIns {
+	defer f.Close()
+
+	return writeCopyLines(f, lines)
+}
+
+func writeCopyLines(w io.Writer, lines []string) (err error) {
+	for _, val := range lines {
 		val = strings.Replace(val, "\t\r\n", "\t\n", -1)
 		//pls use mysql NO_ZERODATES
 		val = strings.Replace(val, `"0000-00-00 00:00:00"`, `NULL`, -1)
-		if _, err = f.WriteString(val + "\t\r\n"); err != nil {
+		if _, err = io.WriteString(w, val+"\t\r\n"); err != nil {
 			return
 		}
 	}
@@ -287,12 +542,56 @@ func (t *tableCache) getInsFile(dataDir string) (filename string, err error) {
 	return
 }
 
+//load csv lines into table, columns list may be empty for all table columns
+func (vc *Cache) copyLines(schema, table string, columns []string, lines []string) (err error) {
+	filename := vc.dataDir + schema + `-` + table
+
+	if vc.copyPipe {
+		return vc.copyPipeLines(schema, table, columns, filename+`.pipe`, lines)
+	}
+
+	if err = writeCopyFile(filename, lines); err != nil {
+		return
+	}
+
+	if err = vc.copyFile(schema, table, columns, filename); err != nil {
+		return
+	}
+
+	return os.Remove(filename)
+}
+
+//load csv file into table, spill files are removed after flush committed
+func (vc *Cache) copyFile(schema, table string, columns []string, filename string) (err error) {
+	copyTpl := `
+		COPY "%s"."%s"%s FROM LOCAL '%s'
+		DELIMITER ',' NULL AS 'NULL' ENCLOSED BY '"' RECORD TERMINATOR E'\t\r\n'
+		REJECTED DATA '` + vc.dataDir + `rejected` + string(os.PathSeparator) + `%s.log'
+		EXCEPTIONS '` + vc.dataDir + `exceptions` + string(os.PathSeparator) + `%s.log' ABORT ON ERROR NO COMMIT`
+
+	var columnsList string
+	if len(columns) > 0 {
+		columnsList = ` ("` + strings.Join(columns, `","`) + `")`
+	}
+
+	copySQL := fmt.Sprintf(copyTpl, schema, table, columnsList, filename, schema+table, schema+table)
+
+	_, err = vc.Exec([]string{copySQL})
+
+	return
+}
+
 func (t *tableCache) tableDeletesExec(vert *Cache) (err error) {
 	if len(t.tDels) == 0 {
 		return
 	}
 
-	delVsql := t.getDelSQL(vert.delPack)
+	delVsql := t.getDelSQL(t.getPack(vert))
+
+	//keys loaded into stage by parallel flush
+	if t.preStaged {
+		delVsql = []string{t.getStageDelSQL()}
+	}
 
 	var aff int64
 	var tr int
@@ -312,33 +611,51 @@ func (t *tableCache) tableDeletesExec(vert *Cache) (err error) {
 	}
 
 	t.tDels = make([]string, 0)
+	t.tDelKeys = make(map[string]string)
 
 	return
 }
 
-func (t *tableCache) tableInsertsExec(vert *Cache) (err error) {
-	if len(t.tIns) == 0 {
+func (t *tableCache) tableSoftDeletesExec(vert *Cache) (err error) {
+	if len(t.tSoftDels) == 0 {
 		return
 	}
 
-	var filename string
-	if filename, err = t.getInsFile(vert.dataDir); err != nil {
+	softDelVsql := t.getSoftDelSQL(t.getPack(vert))
+
+	log.Debugf("Start %d soft dels(packs: %d)", len(t.tSoftDels), len(softDelVsql))
+
+	if _, err = vert.Exec(softDelVsql); err != nil {
 		return
 	}
 
-	copyTpl := `
-		COPY "%s"."%s" FROM LOCAL '%s'
-		DELIMITER ',' NULL AS 'NULL' ENCLOSED BY '"' RECORD TERMINATOR E'\t\r\n'
-		REJECTED DATA '` + vert.dataDir + `rejected` + string(os.PathSeparator) + `%s.log'
-		EXCEPTIONS '` + vert.dataDir + `exceptions` + string(os.PathSeparator) + `%s.log' ABORT ON ERROR NO COMMIT`
+	t.tSoftDels = make([]softDel, 0)
+
+	return
+}
+
+func (t *tableCache) tableInsertsExec(vert *Cache) (err error) {
+	if len(t.tIns) == 0 {
+		return
+	}
+
+	//rows loaded into stage by parallel flush
+	if t.preStaged {
+		if _, err = vert.Exec([]string{t.getStageInsSQL()}); err != nil {
+			return
+		}
 
-	copySQL := fmt.Sprintf(copyTpl, t.schema, t.name, filename, t.schema+t.name, t.schema+t.name)
+		t.tIns = make(map[string]string)
 
-	if _, err = vert.Exec([]string{copySQL}); err != nil {
 		return
 	}
 
-	if err = os.Remove(filename); err != nil {
+	lines := make([]string, 0, len(t.tIns))
+	for _, val := range t.tIns {
+		lines = append(lines, val)
+	}
+
+	if err = vert.copyLines(t.schema, t.name, nil, lines); err != nil {
 		return
 	}
 
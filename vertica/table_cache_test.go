@@ -0,0 +1,33 @@
+package vertica
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/b13f/repligator/isql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseUpdates(t *testing.T) {
+	table := newKeyTable(`collapse`, `id`, `val`)
+
+	upd := rowsChange{op: isql.Update}
+
+	for i := 0; i < 100; i++ {
+		//before image may differ from cached row
+		table.addDel(nil, upd, [][]interface{}{{1, fmt.Sprintf(`old%d`, i)}})
+		assert.NoError(t, table.addIns(nil, upd, [][]interface{}{{1, fmt.Sprintf(`new%d`, i)}}))
+	}
+
+	assert.Equal(t, []string{`1`}, table.tDels)
+	assert.Equal(t, map[string]string{`1`: `"1","new99"`}, table.tIns)
+}
+
+func TestNullKeyRows(t *testing.T) {
+	table := newKeyTable(`nullkey`, `code`, `id`)
+
+	ins := rowsChange{op: isql.Insert}
+
+	assert.NoError(t, table.addIns(nil, ins, [][]interface{}{{nil, 1}, {nil, 2}, {`a`, 3}, {`a`, 4}}))
+	assert.Len(t, table.tIns, 3)
+}
@@ -0,0 +1,64 @@
+package vertica
+
+import (
+	"path"
+)
+
+//TableConfig is destination options for tables matched by name pattern schema.table, * allowed
+type TableConfig struct {
+	Name       string
+	SoftDelete bool `yaml:"soft_delete"`
+	History    bool
+	Flush      string //copy or merge
+	FlushCount int    `yaml:"flush_count"` //rows of table
+	FlushTime  int    `yaml:"flush_time"`  //seconds
+	Pack       int
+}
+
+//return options of first table config matched by name
+func (vc *Cache) getTableConfig(schema, table string) (conf TableConfig) {
+	for _, tc := range vc.tablesConf {
+		if ok, _ := path.Match(tc.Name, schema+`.`+table); ok {
+			return tc
+		}
+	}
+
+	return
+}
+
+//return names of columns added by repligator to table
+func (vc *Cache) getExtraColumns(schema, table string) (names []string) {
+	if len(vc.sourceColumn) > 0 {
+		names = append(names, vc.sourceColumn)
+	}
+
+	if vc.getTableConfig(schema, table).SoftDelete {
+		names = append(names, deletedColumn, deletedAtColumn)
+	}
+
+	names = append(names, vc.metaColumns...)
+
+	return
+}
+
+//return values of columns added by repligator for new row
+func (vc *Cache) getExtraValues(change rowsChange) map[string]interface{} {
+	return map[string]interface{}{
+		vc.sourceColumn: change.source,
+		deletedColumn:   false,
+		deletedAtColumn: nil,
+		gtidColumn:      change.gtid,
+		binlogTsColumn:  change.ts,
+		opColumn:        change.op,
+	}
+}
+
+//return state of primary and unique keys for new table constraints
+func (vc *Cache) getKeyState(schema, table string) string {
+	//deleted versions duplicate keys
+	if vc.getTableConfig(schema, table).SoftDelete {
+		return `DISABLED`
+	}
+
+	return `ENABLED`
+}